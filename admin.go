@@ -0,0 +1,131 @@
+package apifaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRetryAfter the default seconds of Retry-After in maintenance mode
+const defaultRetryAfter = 60
+
+// SetMaintenance turns on or turns off the maintenance mode,
+// in which every fake api responds 503 with a Retry-After header of retryAfter seconds
+func (af *ApiFaker) SetMaintenance(on bool, retryAfter int) {
+	af.Lock()
+	defer af.Unlock()
+
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	af.maintenance = on
+	af.retryAfter = retryAfter
+}
+
+// InMaintenance returns if ApiFaker is in maintenance mode
+func (af *ApiFaker) InMaintenance() bool {
+	af.RLock()
+	defer af.RUnlock()
+	return af.maintenance
+}
+
+// SetReadOnly turns on or turns off the read-only mode,
+// in which every fake api responds 403 to the requests except GET, HEAD and OPTIONS
+func (af *ApiFaker) SetReadOnly(on bool) {
+	af.Lock()
+	defer af.Unlock()
+	af.readOnly = on
+}
+
+// IsReadOnly returns if ApiFaker is in read-only mode
+func (af *ApiFaker) IsReadOnly() bool {
+	af.RLock()
+	defer af.RUnlock()
+	return af.readOnly
+}
+
+// setAdminHandlers set handlers for the admin apis under Prefix + "/admin"
+func (af *ApiFaker) setAdminHandlers(engine *gin.Engine) {
+	admin := engine.Group(af.Prefix + "/admin")
+
+	// POST /admin/maintenance, status=on|off, retry_after=seconds(optional)
+	admin.POST("/maintenance", func(ctx *gin.Context) {
+		status := ctx.PostForm("status")
+		if status != "on" && status != "off" {
+			af.respondError(ctx, http.StatusBadRequest, fmt.Errorf("status must be on or off"))
+			return
+		}
+
+		retryAfter, _ := strconv.Atoi(ctx.PostForm("retry_after"))
+		af.SetMaintenance(status == "on", retryAfter)
+		af.respond(ctx, http.StatusOK, map[string]interface{}{"maintenance": af.InMaintenance()})
+	})
+
+	// POST /admin/recording, status=on|off, size=number(optional)
+	admin.POST("/recording", func(ctx *gin.Context) {
+		status := ctx.PostForm("status")
+		if status != "on" && status != "off" {
+			af.respondError(ctx, http.StatusBadRequest, fmt.Errorf("status must be on or off"))
+			return
+		}
+
+		size, _ := strconv.Atoi(ctx.PostForm("size"))
+		af.SetRecording(status == "on", size)
+		af.respond(ctx, http.StatusOK, map[string]interface{}{"recording": af.IsRecording()})
+	})
+
+	// POST /admin/body_logging, resource=name, status=on|off
+	admin.POST("/body_logging", func(ctx *gin.Context) {
+		status := ctx.PostForm("status")
+		if status != "on" && status != "off" {
+			af.respondError(ctx, http.StatusBadRequest, fmt.Errorf("status must be on or off"))
+			return
+		}
+		resource := ctx.PostForm("resource")
+		router, ok := af.routers()[resource]
+		if !ok {
+			af.respondError(ctx, http.StatusNotFound, fmt.Errorf("unknown resource: %s", resource))
+			return
+		}
+
+		router.Model.SetBodyLogging(status == "on")
+		af.respond(ctx, http.StatusOK, map[string]interface{}{"resource": resource, "body_logging": router.Model.BodyLogging()})
+	})
+
+	// GET /admin/requests responds the recorded requests from the oldest one
+	admin.GET("/requests", func(ctx *gin.Context) {
+		af.respond(ctx, http.StatusOK, af.RecordedRequests())
+	})
+
+	// DELETE /admin/requests clears the recorded requests
+	admin.DELETE("/requests", func(ctx *gin.Context) {
+		af.ClearRecordedRequests()
+		af.respond(ctx, http.StatusOK, nil)
+	})
+
+	// POST /admin/forced_responses, {"method": "GET", "path": "/users", "status": 503, "body": {...}}
+	admin.POST("/forced_responses", func(ctx *gin.Context) {
+		forced := struct {
+			Method string `json:"method"`
+			Path   string `json:"path"`
+			Response
+		}{}
+		if err := json.NewDecoder(ctx.Request.Body).Decode(&forced); err != nil ||
+			forced.Method == "" || forced.Path == "" || forced.Status == 0 {
+			af.respondError(ctx, http.StatusBadRequest, fmt.Errorf("method, path and status are required"))
+			return
+		}
+
+		af.ForceResponse(forced.Method, forced.Path, forced.Response)
+		af.respond(ctx, http.StatusOK, forced)
+	})
+
+	// DELETE /admin/forced_responses?method=GET&path=/users
+	admin.DELETE("/forced_responses", func(ctx *gin.Context) {
+		af.ClearForcedResponse(ctx.Query("method"), ctx.Query("path"))
+		af.respond(ctx, http.StatusOK, nil)
+	})
+}
@@ -0,0 +1,97 @@
+package apifaker
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Aggregate is a computed endpoint like GET /orders/stats,
+// it responds the count, sum, avg, min and max of a number column over the filtered items
+type Aggregate struct {
+	// Column the name of the number column to aggregate
+	Column string `json:"column"`
+
+	// GroupBy the name of a column, the aggregate of every value of it is responded, empty means no groups
+	GroupBy string `json:"group_by,omitempty"`
+}
+
+// hasAggregate returns if model declares the aggregate with the given name
+func (model *Model) hasAggregate(name string) bool {
+	_, ok := model.Aggregates[name]
+	return ok
+}
+
+// CheckAggregatesMeta checks if every aggregate has a number column, a known group_by column,
+// and a name which can not be an id
+func (model *Model) CheckAggregatesMeta() error {
+	for name, aggregate := range model.Aggregates {
+		if _, err := strconv.ParseFloat(name, 64); err == nil || name == randomId || name == "" {
+			return JsonFileErrorf("aggregates has wrong name \"%s\" in model[name=\"%s\"]", name, model.Name)
+		}
+		if aggregate == nil {
+			return JsonFileErrorf("aggregates has empty aggregate \"%s\" in model[name=\"%s\"]", name, model.Name)
+		}
+		if column, ok := model.Column(aggregate.Column); !ok || column.Type != number.Name() {
+			return JsonFileErrorf("aggregate \"%s\" must have a number column in model[name=\"%s\"]", name, model.Name)
+		}
+		if _, ok := model.Column(aggregate.GroupBy); aggregate.GroupBy != "" && !ok {
+			return JsonFileErrorf("aggregate \"%s\" has unknown group_by column \"%s\" in model[name=\"%s\"]", name, aggregate.GroupBy, model.Name)
+		}
+	}
+	return nil
+}
+
+// aggregateValues returns the count, sum, avg, min and max of the given values,
+// avg, min and max are nil without values
+func aggregateValues(values []float64) map[string]interface{} {
+	result := map[string]interface{}{"count": len(values), "sum": float64(0), "avg": nil, "min": nil, "max": nil}
+	if len(values) == 0 {
+		return result
+	}
+
+	sum, min, max := float64(0), values[0], values[0]
+	for _, value := range values {
+		sum += value
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+	result["sum"] = sum
+	result["avg"] = sum / float64(len(values))
+	result["min"] = min
+	result["max"] = max
+	return result
+}
+
+// compute returns the aggregate of the LineItems, only the items having a number value are counted,
+// it is an object using the values of GroupBy as keys if GroupBy is set
+func (aggregate *Aggregate) compute(lis LineItems) map[string]interface{} {
+	if aggregate.GroupBy == "" {
+		values := []float64{}
+		for _, li := range lis {
+			if value, ok := li.dataMap[aggregate.Column].(float64); ok {
+				values = append(values, value)
+			}
+		}
+		return aggregateValues(values)
+	}
+
+	groups := map[string][]float64{}
+	for _, li := range lis {
+		value, ok := li.dataMap[aggregate.Column].(float64)
+		if !ok {
+			continue
+		}
+		key := fmt.Sprint(li.dataMap[aggregate.GroupBy])
+		groups[key] = append(groups[key], value)
+	}
+
+	result := map[string]interface{}{}
+	for key, values := range groups {
+		result[key] = aggregateValues(values)
+	}
+	return result
+}
@@ -1,19 +1,31 @@
 package apifaker
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Focinfi/gtester"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/inflection"
 )
 
+// ApiFaker keeps all of its state, models and routes inside the instance,
+// several ApiFakers can work in one process without interfering each other
 type ApiFaker struct {
 	// Engine in charge of serving http requests
 	*gin.Engine
@@ -29,6 +41,104 @@ type ApiFaker struct {
 
 	// Prefix the prefix of fake apis
 	Prefix string
+
+	// PrettyJSON makes responses use indented json, default false
+	PrettyJSON bool
+
+	// Headers the default headers of every response, Model.Headers overrides them
+	Headers map[string]string
+
+	// ContentRange makes paginated GET /collection respond a Content-Range header like "users 0-9/100",
+	// it is exposed to CORS requests, default false
+	ContentRange bool
+
+	// TenantHeader the request header whose value partitions data by tenants,
+	// every tenant gets its own copy of data initialized from seeds, empty means no tenants
+	TenantHeader string
+
+	// staticRoutes the fixed json responses declared in static_routes.json
+	staticRoutes []StaticRoute
+
+	// server serves at listener between Start and Shutdown
+	server   *http.Server
+	listener net.Listener
+
+	// tenants contains the data of every tenant in every seed profile
+	tenants map[tenantKey]*ApiFaker
+
+	// savepoints the stack of model snapshots pushed by Begin
+	savepoints []map[string]modelSnapshot
+
+	// errorFormat the format of error responses, set by SetErrorFormat
+	errorFormat string
+
+	// trailingSlash the mode of handling paths with a trailing slash, set by SetTrailingSlash
+	trailingSlash string
+
+	// maintenance signs if every fake api responds 503
+	maintenance bool
+
+	// retryAfter the seconds for the Retry-After header in maintenance mode
+	retryAfter int
+
+	// readOnly signs if every fake api rejects the mutating requests with 403
+	readOnly bool
+
+	// beforeHook runs before every handler, set by SetBeforeHook
+	beforeHook gin.HandlerFunc
+
+	// random the source of every feature driven by randomness, seeded by SetSeed
+	random *rand.Rand
+
+	// seeded signs if random is seeded by SetSeed
+	seeded bool
+
+	// quota the request quota of every client, set by SetQuota
+	quota Quota
+
+	// quotaCounters counts the requests of every client in the current window of quota
+	quotaCounters map[string]*quotaCounter
+
+	// deterministic signs if randomness is disabled for reproducible runs, set by SetDeterministic
+	deterministic bool
+
+	// requestCount the count of generated request ids in deterministic mode
+	requestCount uint64
+
+	// recording signs if the requests are recorded, set by SetRecording
+	recording bool
+
+	// recordSize the max number of records
+	recordSize int
+
+	// records the recorded requests from the oldest one
+	records []RecordedRequest
+
+	// transforms the custom transforms registered by RegisterTransform
+	transforms *transformRegistry
+
+	// overrides contains the handlers overriding the generated ones for "resource METHOD"
+	overrides map[string]ModelHandlerFunc
+
+	// forcedResponses contains the responses forced for "METHOD path"
+	forcedResponses map[string]Response
+
+	// mockErrorHeader signs if the X-Mock-Error header is enabled, set by SetMockErrorHeader
+	mockErrorHeader bool
+
+	// validationLogger logs validation failures, set by SetValidationLogger
+	validationLogger *slog.Logger
+
+	// bodyLogger logs the bodies of the models with body logging on, set by SetBodyLogger
+	bodyLogger *slog.Logger
+
+	// addModelLock serializes AddModel
+	addModelLock sync.Mutex
+
+	// handlersLock serializes setHandlers, so the last Engine is built with the last Routers
+	handlersLock sync.Mutex
+
+	sync.RWMutex
 }
 
 // NewWithApiDir alloactes and returns a new ApiFaker with the given dir as its ApiDir,
@@ -38,8 +148,9 @@ type ApiFaker struct {
 //   3. break rules described in README.md
 func NewWithApiDir(dir string) (*ApiFaker, error) {
 	faker := &ApiFaker{
-		ApiDir:  dir,
-		Routers: map[string]*Router{},
+		ApiDir:     dir,
+		Routers:    map[string]*Router{},
+		transforms: newTransformRegistry(),
 	}
 
 	err := gtester.NewInspector().Check(func() error {
@@ -47,24 +158,40 @@ func NewWithApiDir(dir string) (*ApiFaker, error) {
 			if f == nil {
 				return err
 			}
-			if f.IsDir() || !strings.HasSuffix(path, ".json") {
+			if f.IsDir() || !(strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".json.gz")) {
 				return nil
 			}
+			if f.Name() == staticRoutesFileName {
+				return faker.loadStaticRoutes(path)
+			}
 
-			if router, err := NewRouterWithPath(path, faker); err != nil {
+			// a json file could combine models
+			var models []*Model
+			if strings.HasSuffix(path, ".gz") {
+				router, err := NewRouterWithPath(path, faker)
+				if err != nil {
+					return err
+				}
+				models = []*Model{router.Model}
+			} else if models, err = NewModelsWithPath(path, faker); err != nil {
 				return err
-			} else {
-				if _, ok := faker.Routers[router.Model.Name]; ok {
-					return JsonFileErrorf("%s has been existed", router.Model.Name)
+			}
+
+			for _, model := range models {
+				if _, ok := faker.Routers[model.Name]; ok {
+					return JsonFileErrorf("%s has been existed", model.Name)
 				} else {
-					faker.Routers[router.Model.Name] = router
+					faker.Routers[model.Name] = model.router
 				}
 			}
 			return nil
 		})
 	}).
+		Check(faker.CheckRouteNames).
 		Check(faker.CheckUniqueness).
 		Check(faker.CheckRelationships).
+		Check(faker.CheckSeedProfiles).
+		Check(faker.CheckStaticRoutes).
 		Then(func() {
 			faker.setHandlers()
 			faker.setSaveToFileTimer()
@@ -73,6 +200,114 @@ func NewWithApiDir(dir string) (*ApiFaker, error) {
 	return faker, err
 }
 
+// AddModel registers the Model built in go code and sets its routes, e.g. &Model{Name: "users", Columns: ...},
+// go numbers like int in Seeds are converted to float64, the Model is checked like the one in a json file and registered only if all checks pass,
+// it has no json file, so SaveToFile of its Router returns an error
+func (af *ApiFaker) AddModel(model *Model) error {
+	af.addModelLock.Lock()
+	defer af.addModelLock.Unlock()
+
+	if _, ok := af.routers()[model.Name]; ok {
+		return JsonFileErrorf("%s has been existed", model.Name)
+	}
+
+	// go numbers of seeds are float64 in json
+	for _, seed := range model.Seeds {
+		for key, value := range seed {
+			seed[key] = toFloat64(value)
+		}
+	}
+
+	// the model is checked with the existing ones in a staged ApiFaker, af is not changed until all checks pass
+	staged := &ApiFaker{ApiDir: af.ApiDir, Routers: map[string]*Router{}, transforms: af.transforms}
+	for name, router := range af.routers() {
+		staged.Routers[name] = router
+	}
+	router := &Router{apiFaker: staged, Model: model}
+	model.router = router
+	if err := model.checkAndInit(); err != nil {
+		return err
+	}
+	router.setRestRoutes()
+
+	staged.Routers[model.Name] = router
+	err := gtester.NewCheckQueue().
+		Add(staged.CheckRouteNames).
+		Add(model.CheckUniqueness).
+		Add(model.CheckRelationships).
+		Add(staged.CheckSeedProfiles).
+		Run()
+	if err != nil {
+		return err
+	}
+
+	// the existing tenants get the data of the new model too
+	af.Lock()
+	tenantRouters := map[*ApiFaker]map[string]*Router{}
+	for key, tenant := range af.tenants {
+		tenantRouter := &Router{apiFaker: tenant, Routes: router.Routes}
+		if tenantRouter.Model, err = model.clone(tenantRouter, key.profile); err != nil {
+			af.Unlock()
+			return err
+		}
+		tenantRouters[tenant] = map[string]*Router{model.Name: tenantRouter}
+		for name, router := range tenant.routers() {
+			tenantRouters[tenant][name] = router
+		}
+	}
+
+	// the maps of Routers are replaced instead of changed, so the readers holding the old ones are not affected
+	router.apiFaker = af
+	af.Routers = staged.Routers
+	for tenant, routers := range tenantRouters {
+		tenant.Lock()
+		tenant.Routers = routers
+		tenant.Unlock()
+	}
+	af.Unlock()
+
+	af.setHandlers()
+	return nil
+}
+
+// engine returns the Engine serving requests, setHandlers replaces it with a new one
+func (af *ApiFaker) engine() *gin.Engine {
+	af.RLock()
+	defer af.RUnlock()
+	return af.Engine
+}
+
+// routers returns the Routers, AddModel replaces the map instead of changing it,
+// so the returned one could be read without the lock
+func (af *ApiFaker) routers() map[string]*Router {
+	af.RLock()
+	defer af.RUnlock()
+	return af.Routers
+}
+
+// CheckRouteNames checks if every model has a different route name
+func (af *ApiFaker) CheckRouteNames() error {
+	names := map[string]string{}
+	for name, router := range af.Routers {
+		routeName := router.Model.RouteName()
+		if other, ok := names[routeName]; ok {
+			return JsonFileErrorf("%s and %s use the same route name %s", other, name, routeName)
+		}
+		names[routeName] = name
+	}
+	return nil
+}
+
+// routerByRouteName returns the Router whose model has the given route name and if it exists
+func (af *ApiFaker) routerByRouteName(routeName string) (*Router, bool) {
+	for _, router := range af.routers() {
+		if router.Model.RouteName() == routeName {
+			return router, true
+		}
+	}
+	return nil, false
+}
+
 // CheckUniqueness
 func (af *ApiFaker) CheckUniqueness() error {
 	for _, router := range af.Routers {
@@ -93,18 +328,104 @@ func (af *ApiFaker) CheckRelationships() error {
 	return nil
 }
 
+// Validate checks if every foreign key value like "user_id" of every item of every model points to an existing item,
+// it returns a DanglingReferencesError listing all dangling references, null or absent values are skipped
+func (af *ApiFaker) Validate() error {
+	names := []string{}
+	for name := range af.Routers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	references := []string{}
+	for _, name := range names {
+		model := af.Routers[name].Model
+		for _, column := range model.Columns {
+			if !strings.HasSuffix(column.Name, "_id") {
+				continue
+			}
+
+			resName := inflection.Plural(strings.TrimSuffix(column.Name, "_id"))
+			resRouter, hasRes := af.Routers[resName]
+			for _, li := range model.lineItems() {
+				value, ok := li.Get(column.Name)
+				if !ok || value == nil {
+					continue
+				}
+				if id, isNumber := toFloat64(value).(float64); hasRes && isNumber && resRouter.Model.Has(id) {
+					continue
+				}
+				references = append(references, fmt.Sprintf("%s[id=%v].%s=%v points to no item of %s", name, li.Id(), column.Name, value, resName))
+			}
+		}
+	}
+
+	if len(references) > 0 {
+		return DanglingReferencesError{References: references}
+	}
+	return nil
+}
+
+// Stats returns the count of LineItems of every model, using resource name as the key
+func (af *ApiFaker) Stats() map[string]int {
+	routers := af.routers()
+	stats := make(map[string]int, len(routers))
+	for name, router := range routers {
+		stats[name] = router.Model.Len()
+	}
+	return stats
+}
+
 // ServeHTTP implements the http.Handler.
 // It will use Engine when req.URL.Path hasing prefix of Prefix or ExtMux is nil
 // otherwise it will call ApiFaker.ExtMux.ServeHTTP()
 func (af *ApiFaker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	af.RLock()
+	trailingSlash := af.trailingSlash
+	af.RUnlock()
+
 	path := req.URL.Path
+	if trailingSlash == TrailingSlashIgnore && len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+		req.URL.Path = path
+	}
 	if af.Prefix == "" || strings.HasPrefix(path, af.Prefix+"/") || af.ExtMux == nil {
-		af.Engine.ServeHTTP(rw, req)
+		af.engine().ServeHTTP(rw, req)
 	} else {
 		af.ExtMux.ServeHTTP(rw, req)
 	}
 }
 
+// modes of handling paths with a trailing slash, e.g. "/users/"
+const (
+	// TrailingSlashRedirect redirects to the path without the trailing slash, it is the default mode
+	TrailingSlashRedirect = "redirect"
+
+	// TrailingSlashIgnore treats the path as the one without the trailing slash
+	TrailingSlashIgnore = "ignore"
+
+	// TrailingSlashNotFound responds 404
+	TrailingSlashNotFound = "not_found"
+)
+
+// SetTrailingSlash sets the mode of handling paths with a trailing slash and resets the handlers,
+// it returns an error for an unknown mode
+func (af *ApiFaker) SetTrailingSlash(mode string) error {
+	switch mode {
+	case TrailingSlashRedirect, TrailingSlashIgnore, TrailingSlashNotFound:
+	default:
+		return fmt.Errorf("unknown trailing slash mode: %s", mode)
+	}
+
+	af.Lock()
+	af.trailingSlash = mode
+	af.Unlock()
+
+	// the engine reads RedirectTrailingSlash for every request, so a new one is built instead of changing it
+	af.setHandlers()
+	return nil
+}
+
 // MountTo assign path as ApiFaker's Prefix and reset the handlers
 func (af *ApiFaker) MountTo(path string) {
 	af.Prefix = path
@@ -118,7 +439,7 @@ func (af *ApiFaker) IntegrateHandler(handler http.Handler) {
 
 // SaveToFile
 func (af *ApiFaker) SaveToFile() {
-	for _, router := range af.Routers {
+	for _, router := range af.routers() {
 		router.SaveToFile()
 	}
 }
@@ -141,7 +462,7 @@ func (af *ApiFaker) setSaveToFileTimer() {
 	}()
 }
 
-// setHandlers set all handlers into ApiFaker.Engine.
+// setHandlers builds a new Engine with all handlers and replaces ApiFaker.Engine with it
 func (af *ApiFaker) setHandlers() {
 	// if panic, backfill data to json files
 	defer func() {
@@ -151,79 +472,285 @@ func (af *ApiFaker) setHandlers() {
 		}
 	}()
 
-	// reset Engine
-	af.Engine = NewGinEngineWithFaker(af)
+	af.handlersLock.Lock()
+	defer af.handlersLock.Unlock()
 
-	for _, router := range af.Routers {
+	// a new Engine is built and replaces the serving one at last
+	engine := NewGinEngineWithFaker(af)
+	af.setAdminHandlers(engine)
+	af.setStaticHandlers(engine)
+	af.setCatalogHandler(engine)
+	defer func() {
+		af.Lock()
+		af.Engine = engine
+		af.Unlock()
+	}()
+
+	for name, router := range af.routers() {
+		name := name
 		for _, route := range router.Routes {
-			model := router.Model
-			method := route.Method
 			path := af.Prefix + route.Path
-			switch method {
-			case GET:
-				af.GET(path, func(ctx *gin.Context) {
-					if id, ok := ctx.Get("idFloat64"); ok {
-						// GET /collection/:id
-						li, _ := model.Get(id.(float64))
-						newLi := li.InsertRelatedData(model)
-						ctx.JSON(http.StatusOK, newLi.ToMap())
-					} else {
-						// GET /collection
-						models := model.ToLineItems()
-						sort.Sort(models)
-						ctx.JSON(http.StatusOK, models.ToSlice())
-					}
-				})
-			case POST:
-				af.POST(path, func(ctx *gin.Context) {
-					li, err := NewLineItemWithGinContext(ctx, model)
-					if err == nil {
-						err = model.Add(li)
-					}
 
-					if err != nil {
-						ctx.JSON(http.StatusBadRequest, ResponseErrorMsg(err))
-					} else {
-						ctx.JSON(http.StatusOK, li.ToMap())
+			var handler func(*gin.Context, *Model)
+			switch route.Action {
+			case IndexAction:
+				handler = af.index
+			case ShowAction:
+				handler = af.show
+			case CreateAction:
+				handler = af.create
+			case UpdateAction:
+				if route.Method == PATCH {
+					handler = af.patch
+				} else {
+					handler = af.update
+				}
+			case DeleteAction:
+				handler = af.destroy
+			case csvAction:
+				handler = af.exportCSV
+			case replaceAction:
+				handler = af.replaceAll
+			case blobAction:
+				column := route.Path[strings.LastIndex(route.Path, "/")+1:]
+				handler = func(ctx *gin.Context, model *Model) {
+					af.blob(ctx, model, column)
+				}
+			}
+
+			// the routes besides the restful ones are allowed with the actions in extraActions
+			action := route.Action
+			if allowedWith, ok := extraActions[action]; ok {
+				action = allowedWith
+			}
+			if !router.Model.Allows(action) {
+				handler = af.notAllowed
+			}
+
+			// GET /collection/random and the aggregates like GET /collection/stats share the route with GET /collection/:id,
+			// they are allowed with the index action
+			if route.Action == ShowAction {
+				show := handler
+				handler = func(ctx *gin.Context, model *Model) {
+					id := ctx.Param("id")
+					switch {
+					case id != randomId && !model.hasAggregate(id):
+						show(ctx, model)
+					case !model.Allows(IndexAction):
+						af.notAllowed(ctx, model)
+					case id == randomId:
+						af.randomIndex(ctx, model)
+					default:
+						af.aggregate(ctx, model, id)
 					}
-				})
-			case PUT:
-				af.PUT(path, func(ctx *gin.Context) {
-					// allocate a new item
-					newLi, err := NewLineItemWithGinContext(ctx, model)
-
-					if err != nil {
-						ctx.JSON(http.StatusBadRequest, ResponseErrorMsg(err))
+				}
+			}
+			engine.Handle(route.Method.String(), path, func(ctx *gin.Context) {
+				scoped, err := af.scoped(ctx)
+				if err != nil {
+					af.respondError(ctx, ErrorStatus(err), err)
+					return
+				}
+				model := scoped.routers()[name].Model
+				ctx.Set("resource", name)
+				for key, value := range model.Headers {
+					ctx.Header(key, value)
+				}
+				// the data responded depends on the tenant and the seed profile
+				if ctx.Request.Method == "GET" {
+					addVary(ctx, af.TenantHeader, seedProfileHeader)
+				}
+				if err := model.CheckRequiredParams(ctx.Request.URL.Query()); err != nil {
+					af.respondError(ctx, ErrorStatus(err), err)
+					return
+				}
+				// a singleton is routed without id
+				if model.Singleton {
+					id, ok := model.singletonId()
+					if !ok {
+						af.respondError(ctx, http.StatusNotFound, nil)
 						return
 					}
-
-					// update
-					id, _ := ctx.Get("idFloat64")
-					if err := model.Update(id.(float64), &newLi); err != nil {
-						ctx.JSON(http.StatusBadRequest, ResponseErrorMsg(err))
-					} else {
-						ctx.JSON(http.StatusOK, newLi.ToMap())
-					}
-				})
-			case PATCH:
-				af.PATCH(path, func(ctx *gin.Context) {
-					// update with attrs, got error if attrs is not complete
-					id, _ := ctx.Get("idFloat64")
-					if li, err := model.UpdateWithAttrs(id.(float64), ctx); err != nil {
-						ctx.JSON(http.StatusBadRequest, ResponseErrorMsg(err))
-					} else {
-						ctx.JSON(http.StatusOK, li.ToMap())
+					ctx.Set("idFloat64", id)
+				}
+				// simulate the latency of the method, stop waiting if the request is canceled
+				if delay := model.delayOf(ctx.Request.Method); delay > 0 {
+					select {
+					case <-time.After(delay):
+					case <-ctx.Request.Context().Done():
+						return
 					}
-				})
-			case DELETE:
-				af.DELETE(path, func(ctx *gin.Context) {
-					// delete
-					id, _ := ctx.Get("idFloat64")
-					model.Delete(id.(float64))
-					ctx.JSON(http.StatusOK, nil)
-				})
+				}
+				// the flag is shared by the tenants
+				if af.routers()[name].Model.BodyLogging() {
+					defer af.logBodies(ctx, name)()
+				}
+				if override, ok := af.overrideHandler(name, ctx.Request.Method); ok {
+					override(ctx, model)
+					return
+				}
+				handler(ctx, model)
+			})
+		}
+	}
+}
+
+// SetBeforeHook sets the hook which runs before every handler, including the admin apis,
+// it can inspect or modify the gin.Context, e.g. ctx.Set("tenant", ctx.Request.Header.Get("X-Tenant")),
+// call ctx.Abort() after responding to stop the request, nil removes the hook
+func (af *ApiFaker) SetBeforeHook(hook gin.HandlerFunc) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.beforeHook = hook
+}
+
+// SetSeed seeds the random source shared by every feature driven by randomness,
+// e.g. GET /collection/random and request ids, for varied but reproducible runs
+func (af *ApiFaker) SetSeed(seed int64) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.random = rand.New(rand.NewSource(seed))
+	af.seeded = true
+}
+
+// SeedRandom seeds the source of GET /collection/random for reproducible responses, it is the same as SetSeed
+func (af *ApiFaker) SeedRandom(seed int64) {
+	af.SetSeed(seed)
+}
+
+// deterministicSeed the seed of the random source in deterministic mode
+const deterministicSeed = 1
+
+// SetDeterministic turns on or turns off the deterministic mode for reproducible test runs,
+// in which the random source is seeded by deterministicSeed and the generated request ids are sequential,
+// every feature driven by randomness should be reproducible in this mode
+func (af *ApiFaker) SetDeterministic(on bool) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.deterministic = on
+	af.requestCount = 0
+	if on {
+		af.random = rand.New(rand.NewSource(deterministicSeed))
+	}
+}
+
+// IsDeterministic returns if ApiFaker is in deterministic mode
+func (af *ApiFaker) IsDeterministic() bool {
+	af.RLock()
+	defer af.RUnlock()
+	return af.deterministic
+}
+
+// generateRequestID returns a new request id, it is sequential in deterministic mode
+// and drawn from the seeded random source after SetSeed
+func (af *ApiFaker) generateRequestID() string {
+	af.Lock()
+	defer af.Unlock()
+
+	if af.deterministic {
+		af.requestCount++
+		return fmt.Sprintf("%032x", af.requestCount)
+	}
+	if af.seeded {
+		bytes := make([]byte, 16)
+		af.randomSource().Read(bytes)
+		return hex.EncodeToString(bytes)
+	}
+	return newRequestID()
+}
+
+// randomSample calls Model.randomSample with the random source of af
+func (af *ApiFaker) randomSample(model *Model, lis LineItems, query url.Values) (LineItems, error) {
+	af.Lock()
+	defer af.Unlock()
+
+	return model.randomSample(lis, query, af.randomSource())
+}
+
+// randomSource returns the random source of af, it is seeded by the current time if no seed is set,
+// the caller must hold the lock of af
+func (af *ApiFaker) randomSource() *rand.Rand {
+	if af.random == nil {
+		af.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return af.random
+}
+
+// respond writes obj as json into the response with the given code,
+// the json is indented if PrettyJSON is true
+func (af *ApiFaker) respond(ctx *gin.Context, code int, obj interface{}) {
+	if !bodyAllowedForStatus(code) {
+		ctx.Status(code)
+		return
+	}
+
+	if af.PrettyJSON {
+		ctx.IndentedJSON(code, obj)
+	} else {
+		ctx.JSON(code, obj)
+	}
+}
+
+// bodyAllowedForStatus returns if a response with the status code could have a body, 1xx, 204 and 304 could not
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code < 200, code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// ndjsonMediaType the media type of newline-delimited json
+const ndjsonMediaType = "application/x-ndjson"
+
+// acceptsNDJSON returns if the Accept header of the request asks for newline-delimited json
+func acceptsNDJSON(ctx *gin.Context) bool {
+	return strings.Contains(ctx.Request.Header.Get("Accept"), ndjsonMediaType)
+}
+
+// addVary adds the request headers which influence the response to its Vary header for caches,
+// the ones already in it are skipped
+func addVary(ctx *gin.Context, headers ...string) {
+	vary := []string{}
+	if value := ctx.Writer.Header().Get("Vary"); value != "" {
+		vary = strings.Split(value, ",")
+	}
+
+Headers:
+	for _, header := range headers {
+		if header == "" {
+			continue
+		}
+		for _, existing := range vary {
+			if strings.EqualFold(strings.TrimSpace(existing), header) {
+				continue Headers
 			}
 		}
+		vary = append(vary, header)
+	}
+
+	for i := range vary {
+		vary[i] = strings.TrimSpace(vary[i])
+	}
+	if len(vary) > 0 {
+		ctx.Header("Vary", strings.Join(vary, ", "))
+	}
+}
+
+// respondNDJSON streams every item as a line of json into the response with the given code,
+// the keys are in the order of the columns of model
+func (af *ApiFaker) respondNDJSON(ctx *gin.Context, code int, model *Model, items []map[string]interface{}) {
+	ctx.Header("Content-Type", ndjsonMediaType)
+	ctx.Status(code)
+	encoder := json.NewEncoder(ctx.Writer)
+	for _, item := range items {
+		if err := encoder.Encode(model.ordered(item)); err != nil {
+			return
+		}
+		ctx.Writer.Flush()
 	}
 }
 
@@ -231,33 +758,183 @@ func (af *ApiFaker) setHandlers() {
 // added a new middleware which will check the type id param and the resource existence,
 // if ok, set the float64 value of id named idFloat64, otherwise response 404 or 400.
 func NewGinEngineWithFaker(faker *ApiFaker) *gin.Engine {
+	// do not touch gin's process-wide mode, other fakers or engines may rely on it
 	engine := gin.Default()
-	gin.SetMode(gin.ReleaseMode)
-	// check id
+	faker.RLock()
+	engine.RedirectTrailingSlash = faker.trailingSlash == "" || faker.trailingSlash == TrailingSlashRedirect
+	faker.RUnlock()
+	// request id, read from X-Request-ID or generated, echoed in the response
 	engine.Use(func(ctx *gin.Context) {
-		// check if param "id" is int
-		idStr := ctx.Param("id")
-		if idStr == "" {
+		requestID := ctx.Request.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = faker.generateRequestID()
+		}
+		ctx.Set("requestID", requestID)
+		ctx.Header("X-Request-ID", requestID)
+	})
+
+	// record requests, admin apis are not recorded
+	engine.Use(func(ctx *gin.Context) {
+		if !strings.HasPrefix(ctx.Request.URL.Path, faker.Prefix+"/admin/") {
+			faker.record(ctx)
+		}
+	})
+
+	// default headers
+	engine.Use(func(ctx *gin.Context) {
+		for key, value := range faker.Headers {
+			ctx.Header(key, value)
+		}
+	})
+
+	// the global before hook
+	engine.Use(func(ctx *gin.Context) {
+		faker.RLock()
+		hook := faker.beforeHook
+		faker.RUnlock()
+		if hook != nil {
+			hook(ctx)
+		}
+	})
+
+	// maintenance mode, admin apis are still available
+	engine.Use(func(ctx *gin.Context) {
+		if !faker.InMaintenance() || strings.HasPrefix(ctx.Request.URL.Path, faker.Prefix+"/admin/") {
 			return
 		}
 
-		id, err := strconv.ParseFloat(idStr, 64)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, ResponseErrorMsg(err))
+		faker.RLock()
+		retryAfter := faker.retryAfter
+		faker.RUnlock()
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		faker.respondError(ctx, http.StatusServiceUnavailable, fmt.Errorf("service is under maintenance"))
+		ctx.Abort()
+	})
+
+	// read-only mode, reads and admin apis are still available
+	engine.Use(func(ctx *gin.Context) {
+		if !faker.IsReadOnly() || strings.HasPrefix(ctx.Request.URL.Path, faker.Prefix+"/admin/") {
+			return
+		}
+
+		switch ctx.Request.Method {
+		case "GET", "HEAD", "OPTIONS":
+			return
+		}
+		faker.respondError(ctx, http.StatusForbidden, fmt.Errorf("service is read-only"))
+		ctx.Abort()
+	})
+
+	// request quota, admin apis are not counted
+	engine.Use(func(ctx *gin.Context) {
+		if !strings.HasPrefix(ctx.Request.URL.Path, faker.Prefix+"/admin/") {
+			faker.checkQuota(ctx)
+		}
+	})
+
+	// forced responses and mock errors, admin apis can not be forced
+	engine.Use(func(ctx *gin.Context) {
+		if strings.HasPrefix(ctx.Request.URL.Path, faker.Prefix+"/admin/") {
+			return
+		}
+
+		if response, ok := faker.forcedResponse(ctx.Request.Method, ctx.Request.URL.Path); ok {
+			faker.respond(ctx, response.Status, response.Body)
+			ctx.Abort()
+			return
+		}
+
+		// the error of a single request asked by the X-Mock-Error header
+		if status, ok, err := faker.mockError(ctx); err != nil {
+			faker.respondError(ctx, http.StatusBadRequest, err)
+			ctx.Abort()
+		} else if ok {
+			faker.respondError(ctx, status, fmt.Errorf("mock error: %s", http.StatusText(status)))
+			ctx.Abort()
+		}
+	})
+
+	// seed profile must be known
+	engine.Use(func(ctx *gin.Context) {
+		profile := ctx.Request.Header.Get(seedProfileHeader)
+		if profile != "" && !faker.hasSeedProfile(profile) {
+			faker.respondError(ctx, http.StatusBadRequest, fmt.Errorf("unknown seed profile: %s", profile))
+			ctx.Abort()
+		}
+	})
+
+	// check id
+	engine.Use(func(ctx *gin.Context) {
+		// check if param "id" is an integer or formatted by Model.IdFormat, a malformed id gets 400 instead of 404
+		idStr := ctx.Param("id")
+		if idStr == "" || (ctx.Request.Method == "GET" && idStr == randomId) {
+			return
 		}
 
 		path := strings.TrimSuffix(ctx.Request.URL.Path, "/")
 		pathPieces := strings.Split(path, "/")
 		resourceName := pathPieces[len(pathPieces)-2]
+		// the id is followed by the blob column in GET /collection/:id/<column>
+		if resourceName == idStr && len(pathPieces) > 2 {
+			resourceName = pathPieces[len(pathPieces)-3]
+		}
 
-		if router, ok := faker.Routers[resourceName]; ok {
-			if _, ok := router.Model.Get(id); ok {
+		// the id could be formatted by Model.IdFormat
+		scoped, err := faker.scoped(ctx)
+		if err != nil {
+			faker.respondError(ctx, ErrorStatus(err), err)
+			ctx.Abort()
+			return
+		}
+		router, hasRouter := scoped.routerByRouteName(resourceName)
+		if hasRouter && ctx.Request.Method == "GET" && router.Model.hasAggregate(idStr) {
+			return
+		}
+		var id float64
+		if hasRouter {
+			id, err = router.Model.ParseId(idStr)
+		} else if id, err = strconv.ParseFloat(idStr, 64); err != nil {
+			err = ParamsErrorf("invalid id: %s", idStr)
+		}
+		if err != nil {
+			faker.respondError(ctx, http.StatusBadRequest, err)
+			ctx.Abort()
+			return
+		}
+
+		if hasRouter {
+			model := router.Model
+			li, found := model.Get(id)
+			switch {
+			case found && model.IsDeleted(li) && !(ctx.Request.Method == "GET" && model.ShowDeleted):
+				// soft deleted items are gone except for GET /collection/:id with ShowDeleted
+				found = false
+			case !found && ctx.Request.Method == "PUT" && model.Upsert:
+				// PUT creates the missing item of a model with Upsert
+				found = true
+			}
+
+			if found {
 				ctx.Set("idFloat64", id)
+			} else if model.IsGone(id) {
+				// the item deleted with GoneOnDelete
+				faker.respondError(ctx, http.StatusGone, fmt.Errorf("item[id=%s] has been deleted", idStr))
+				ctx.Abort()
 			} else {
-				ctx.JSON(http.StatusNotFound, nil)
+				faker.respondError(ctx, http.StatusNotFound, nil)
+				ctx.Abort()
 			}
 		}
 	})
 
 	return engine
 }
+
+// newRequestID returns a random hex string for X-Request-ID
+func newRequestID() string {
+	bytes := make([]byte, 16)
+	if _, err := crand.Read(bytes); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(bytes)
+}
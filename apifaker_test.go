@@ -1,13 +1,24 @@
 package apifaker
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Focinfi/gtester"
 	"github.com/Focinfi/gtester/httpmock"
+	"github.com/gin-gonic/gin"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var Describ = Convey
@@ -74,6 +85,44 @@ func shouldHasJsonResponse(response interface{}, exp ...interface{}) string {
 	return ""
 }
 
+// serveWithHeaders lets handler serve a request with the given form and headers
+func serveWithHeaders(handler http.Handler, method, path string, form url.Values, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// serveJSON lets handler serve a request with the given json body
+func serveJSON(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// jsonMap decodes the json object in the body of the recorder
+func jsonMap(recorder *httptest.ResponseRecorder) map[string]interface{} {
+	m := map[string]interface{}{}
+	json.Unmarshal(recorder.Body.Bytes(), &m)
+	return m
+}
+
+func jsonSlice(recorder *httptest.ResponseRecorder) []interface{} {
+	slice := []interface{}{}
+	json.Unmarshal(recorder.Body.Bytes(), &slice)
+	return slice
+}
+
 func TestApiFaker(t *testing.T) {
 	faker, err := NewWithApiDir(testDir)
 	userModel := faker.Routers["users"].Model
@@ -89,6 +138,12 @@ func TestApiFaker(t *testing.T) {
 		})
 	})
 
+	Describ("Stats", t, func() {
+		It("returns count of every model", func() {
+			Expect(faker.Stats(), ShouldResemble, map[string]int{"users": 3, "books": 3, "avatars": 1})
+		})
+	})
+
 	httpmock.ListenAndServe("localhost", faker)
 	Describ("SetHandlers", t, func() {
 		Describ("GET /users/:id", func() {
@@ -158,6 +213,13 @@ func TestApiFaker(t *testing.T) {
 				})
 			})
 
+			Context("when pass only_changed=true", func() {
+				response, _ := httpmock.PATCH("/users/4?only_changed=true", map[string]interface{}{"name": "Vince", "age": "22"})
+				It("returns only the changed fields and id", func() {
+					Expect(response, shouldHasJsonResponse, map[string]interface{}{"id": float64(4), "name": "Vince"})
+				})
+			})
+
 			Context("when pass invalid params", func() {
 				response, _ := httpmock.PATCH("/users/4", invalidUserParam)
 				It("returns 404", func() {
@@ -191,8 +253,8 @@ func TestApiFaker(t *testing.T) {
 
 		Describ("DELETE /users/:id", func() {
 			response := httpmock.DELETE("/users/1", nil)
-			It("returns 200 and delete all related resources", func() {
-				Expect(response.Code, ShouldEqual, http.StatusOK)
+			It("returns 204 and delete all related resources", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
 				Expect(faker.Routers["users"].Model.Len(), ShouldEqual, 3)
 				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 1)
 				Expect(faker.Routers["books"].Model.Has(float64(2)), ShouldBeTrue)
@@ -220,3 +282,2424 @@ func TestApiFaker(t *testing.T) {
 		})
 	})
 }
+
+func TestIsolatedFakers(t *testing.T) {
+	faker1, _ := NewWithApiDir(testDir)
+	faker2, _ := NewWithApiDir(testDir)
+	faker1.Routers["users"].Model.Delete(float64(1))
+
+	Describ("Isolated fakers", t, func() {
+		It("does not share models between instances", func() {
+			Expect(faker1.Routers["users"].Model.Has(float64(1)), ShouldBeFalse)
+			Expect(faker2.Routers["users"].Model.Has(float64(1)), ShouldBeTrue)
+			Expect(faker2.Routers["books"].Model.Len(), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	httpmock.ListenAndServe("localhost", faker)
+
+	Describ("POST /admin/maintenance", t, func() {
+		Context("when turn on", func() {
+			httpmock.POSTForm("/admin/maintenance", map[string]interface{}{"status": "on", "retry_after": 120})
+			response := httpmock.GET("/users", nil)
+			It("returns 503 with Retry-After", func() {
+				Expect(response.Code, ShouldEqual, http.StatusServiceUnavailable)
+				Expect(response.Header().Get("Retry-After"), ShouldEqual, "120")
+			})
+		})
+
+		Context("when turn off", func() {
+			httpmock.POSTForm("/admin/maintenance", map[string]interface{}{"status": "off"})
+			response := httpmock.GET("/users", nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.SetReadOnly(true)
+
+	Describ("SetReadOnly", t, func() {
+		Context("when read", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when write", func() {
+			form := url.Values{"name": {"Ameng"}, "phone": {"13213213214"}, "age": {"22"}}
+			created := serveWithHeaders(faker, "POST", "/users", form, nil)
+			deleted := serveWithHeaders(faker, "DELETE", "/users/1", nil, nil)
+			It("returns 403 and keeps the data", func() {
+				Expect(created.Code, ShouldEqual, http.StatusForbidden)
+				Expect(deleted.Code, ShouldEqual, http.StatusForbidden)
+				Expect(serveWithHeaders(faker, "GET", "/users/1", nil, nil).Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when turn off", func() {
+			faker.SetReadOnly(false)
+			response := serveWithHeaders(faker, "DELETE", "/users/1", nil, nil)
+			It("returns 204", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
+			})
+		})
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	form := url.Values{"name": {"Ameng"}, "phone": {"13213213214"}, "age": {"22"}}
+	headers := map[string]string{"Idempotency-Key": "create-ameng"}
+
+	Describ("POST /users with Idempotency-Key", t, func() {
+		first := serveWithHeaders(faker, "POST", "/users", form, headers)
+		second := serveWithHeaders(faker, "POST", "/users", form, headers)
+		It("returns the user created before", func() {
+			Expect(first.Code, ShouldEqual, http.StatusOK)
+			Expect(second.Code, ShouldEqual, http.StatusOK)
+			Expect(jsonMap(second)["id"], ShouldEqual, jsonMap(first)["id"])
+			Expect(faker.Routers["users"].Model.Len(), ShouldEqual, 4)
+		})
+	})
+
+	Describ("concurrent POST /users with the same Idempotency-Key", t, func() {
+		faker, _ := NewWithApiDir(testDir)
+		headers := map[string]string{"Idempotency-Key": "create-ameng-concurrently"}
+		ids := make([]interface{}, 8)
+		var wg sync.WaitGroup
+		for i := range ids {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ids[i] = jsonMap(serveWithHeaders(faker, "POST", "/users", form, headers))["id"]
+			}(i)
+		}
+		wg.Wait()
+		It("creates only one user", func() {
+			Expect(faker.Routers["users"].Model.Len(), ShouldEqual, 4)
+			for _, id := range ids {
+				Expect(id, ShouldEqual, ids[0])
+			}
+		})
+	})
+}
+
+func TestPagination(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /users with limit and cursor", t, func() {
+		first := serveWithHeaders(faker, "GET", "/users?limit=2", nil, nil)
+		cursor := first.Header().Get("X-Next-Cursor")
+		second := serveWithHeaders(faker, "GET", "/users?limit=2&after="+cursor, nil, nil)
+		It("returns pages in order", func() {
+			Expect(first.Code, ShouldEqual, http.StatusOK)
+			Expect(cursor, ShouldNotEqual, "")
+			Expect(second.Code, ShouldEqual, http.StatusOK)
+			Expect(second.Header().Get("X-Next-Cursor"), ShouldEqual, "")
+			Expect(strings.Contains(second.Body.String(), "Foci"), ShouldBeTrue)
+		})
+	})
+
+	Describ("GET /users with default_limit", t, func() {
+		faker.Routers["users"].Model.DefaultLimit = 2
+		defer func() { faker.Routers["users"].Model.DefaultLimit = 0 }()
+
+		Context("when has no limit", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("returns the first page and truncation headers", func() {
+				Expect(strings.Contains(response.Body.String(), "Foci"), ShouldBeFalse)
+				Expect(response.Header().Get("X-Truncated"), ShouldEqual, "true")
+				Expect(response.Header().Get("X-Total-Count"), ShouldEqual, "3")
+			})
+		})
+
+		Context("when all=true", func() {
+			response := serveWithHeaders(faker, "GET", "/users?all=true", nil, nil)
+			It("returns all users", func() {
+				Expect(strings.Contains(response.Body.String(), "Foci"), ShouldBeTrue)
+				Expect(response.Header().Get("X-Truncated"), ShouldEqual, "")
+			})
+		})
+	})
+
+	Describ("GET /users with limit and offset", t, func() {
+		response := serveWithHeaders(faker, "GET", "/users?limit=1&offset=1", nil, nil)
+		It("returns the second user", func() {
+			Expect(strings.Contains(response.Body.String(), "Antony"), ShouldBeTrue)
+			Expect(strings.Contains(response.Body.String(), "Frank"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestHiddenColumn(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.Columns[2].Hidden = true
+	faker.Routers["books"].Model.Columns[2].Hidden = true
+
+	Describ("GET /users/:id with hidden columns", t, func() {
+		response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+		user := jsonMap(response)
+		_, hasPhone := user["phone"]
+		book, _ := user["books"].([]interface{})[0].(map[string]interface{})
+		_, hasUserId := book["user_id"]
+		It("omits hidden columns of the user and the related books", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(hasPhone, ShouldBeFalse)
+			Expect(hasUserId, ShouldBeFalse)
+			Expect(book["title"], ShouldEqual, "The Little Prince")
+		})
+	})
+}
+
+func TestPrettyJSON(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("PrettyJSON", t, func() {
+		Context("when false", func() {
+			response := serveWithHeaders(faker, "GET", "/users/3", nil, nil)
+			It("responds compact json", func() {
+				Expect(strings.Contains(response.Body.String(), "\n"), ShouldBeFalse)
+			})
+		})
+
+		Context("when true", func() {
+			faker.PrettyJSON = true
+			response := serveWithHeaders(faker, "GET", "/users/3", nil, nil)
+			It("responds indented json", func() {
+				Expect(strings.Contains(response.Body.String(), "\n    \""), ShouldBeTrue)
+				Expect(jsonMap(response)["name"], ShouldEqual, "Foci")
+			})
+		})
+	})
+}
+
+func TestContentTypes(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("POST /users with json body", t, func() {
+		response := serveJSON(faker, "POST", "/users", `{"name": "Ameng", "phone": "13213213214", "age": 22}`)
+		It("creates the user", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(jsonMap(response)["age"], ShouldEqual, float64(22))
+		})
+	})
+
+	Describ("POST /users with unsupported Content-Type", t, func() {
+		response := serveWithHeaders(faker, "POST", "/users", nil, map[string]string{"Content-Type": "text/plain"})
+		It("returns 415", func() {
+			Expect(response.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+		})
+	})
+
+	Describ("PATCH /users/:id with a form when only json is accepted", t, func() {
+		faker.Routers["users"].Model.ContentTypes = []string{"application/json"}
+		response := serveWithHeaders(faker, "PATCH", "/users/1", url.Values{"age": {"23"}}, nil)
+		It("returns 415", func() {
+			Expect(response.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+		})
+	})
+}
+
+func TestLastModified(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	li, _ := faker.Routers["users"].Model.Get(float64(1))
+	li.Set("updated_at", "2016-01-02T15:04:05Z")
+
+	Describ("GET /users/:id with updated_at", t, func() {
+		Context("when has no If-Modified-Since", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns Last-Modified", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(response.Header().Get("Last-Modified"), ShouldEqual, "Sat, 02 Jan 2016 15:04:05 GMT")
+			})
+		})
+
+		Context("when has not been modified since", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, map[string]string{
+				"If-Modified-Since": "Sun, 03 Jan 2016 00:00:00 GMT",
+			})
+			It("returns 304", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotModified)
+			})
+		})
+
+		Context("when has been modified since", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, map[string]string{
+				"If-Modified-Since": "Fri, 01 Jan 2016 00:00:00 GMT",
+			})
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestForcedResponses(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("POST /admin/forced_responses", t, func() {
+		serveJSON(faker, "POST", "/admin/forced_responses", `{"method": "GET", "path": "/users", "status": 503, "body": {"message": "down"}}`)
+
+		Context("when request the forced route", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("returns the forced response", func() {
+				Expect(response.Code, ShouldEqual, http.StatusServiceUnavailable)
+				Expect(jsonMap(response)["message"], ShouldEqual, "down")
+			})
+		})
+
+		Context("when request other routes", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+
+	Describ("DELETE /admin/forced_responses", t, func() {
+		serveWithHeaders(faker, "DELETE", "/admin/forced_responses?method=GET&path=/users", nil, nil)
+		response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+		It("stops forcing the response", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+func TestActions(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.Actions = []string{IndexAction, ShowAction}
+	faker.setHandlers()
+
+	Describ("read-only users", t, func() {
+		Context("when request an allowed action", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when request a disabled action", func() {
+			count := faker.Routers["users"].Model.Len()
+			response := serveJSON(faker, "POST", "/users", `{"name": "Bob", "phone": "18600000000", "age": 20}`)
+			It("returns 405", func() {
+				Expect(response.Code, ShouldEqual, http.StatusMethodNotAllowed)
+				Expect(faker.Routers["users"].Model.Len(), ShouldEqual, count)
+			})
+		})
+
+		Context("when request a disabled action of a missing item", func() {
+			response := serveWithHeaders(faker, "DELETE", "/users/100", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestInclude(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /users/1?include=", t, func() {
+		Context("when include a resource with the foreign key", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1?include=avatars", nil, nil)
+			It("embeds the related collection", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				avatars, _ := jsonMap(response)["avatars"].([]interface{})
+				Expect(len(avatars), ShouldEqual, 1)
+			})
+		})
+
+		Context("when the collection is larger than include_limit", func() {
+			faker.Routers["users"].Model.IncludeLimit = 1
+			response := serveWithHeaders(faker, "GET", "/users/1?include=books", nil, nil)
+			faker.Routers["users"].Model.IncludeLimit = 0
+			It("embeds the limited collection", func() {
+				books, _ := jsonMap(response)["books"].([]interface{})
+				Expect(len(books), ShouldEqual, 1)
+			})
+		})
+
+		Context("when include an unknown resource", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1?include=comments", nil, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("X-Request-ID", t, func() {
+		Context("when request with X-Request-ID", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, map[string]string{"X-Request-ID": "abc"})
+			It("echoes it", func() {
+				Expect(response.Header().Get("X-Request-ID"), ShouldEqual, "abc")
+			})
+		})
+
+		Context("when request without X-Request-ID", func() {
+			response := serveWithHeaders(faker, "GET", "/users/100", nil, nil)
+			It("generates one", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+				Expect(response.Header().Get("X-Request-ID"), ShouldNotEqual, "")
+			})
+		})
+	})
+}
+
+func TestEmptyResponse(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.EmptyResponse = &Response{Status: http.StatusNotFound, Body: map[string]interface{}{"data": []interface{}{}}}
+
+	Describ("GET /books with empty_response", t, func() {
+		Context("when no item is left after filtering", func() {
+			faker.Routers["books"].Model.Columns = append(faker.Routers["books"].Model.Columns, &Column{Name: "published_on", Type: "date"})
+			response := serveWithHeaders(faker, "GET", "/books?published_on_after=2016-01-01", nil, nil)
+			faker.Routers["books"].Model.Columns = faker.Routers["books"].Model.Columns[:3]
+			It("returns the empty response", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+				Expect(jsonMap(response)["data"], ShouldResemble, []interface{}{})
+			})
+		})
+
+		Context("when there are items", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestRandom(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /books/random", t, func() {
+		Context("when pass n", func() {
+			response := serveWithHeaders(faker, "GET", "/books/random?n=2", nil, nil)
+			It("returns n random items", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+			})
+		})
+
+		Context("when n is larger than the count of items", func() {
+			response := serveWithHeaders(faker, "GET", "/books/random?n=10&weight=user_id", nil, nil)
+			It("returns all items", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 3)
+			})
+		})
+
+		Context("when filtered by a column", func() {
+			response := serveWithHeaders(faker, "GET", "/books/random?n=10&user_id=1", nil, nil)
+			It("chooses from the matched items", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				for _, item := range jsonSlice(response) {
+					Expect(item.(map[string]interface{})["user_id"], ShouldEqual, 1)
+				}
+			})
+		})
+
+		Context("when seeded", func() {
+			faker.SeedRandom(42)
+			first := serveWithHeaders(faker, "GET", "/books/random", nil, nil).Body.String()
+			faker.SeedRandom(42)
+			second := serveWithHeaders(faker, "GET", "/books/random", nil, nil).Body.String()
+			It("returns the same items", func() {
+				Expect(first, ShouldEqual, second)
+			})
+		})
+
+		Context("when weight is not a number column", func() {
+			response := serveWithHeaders(faker, "GET", "/books/random?weight=title", nil, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestAsync(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	model := faker.Routers["books"].Model
+	model.Columns = append(model.Columns, &Column{Name: "status", Type: "string"})
+	model.Async = true
+	model.AsyncDelay = 20
+	model.Route = "novels"
+	faker.Routers["books"].setRestRoutes()
+	faker.setHandlers()
+
+	Describ("POST /novels when async", t, func() {
+		response := serveWithHeaders(faker, "POST", "/novels", url.Values{"title": {"Async"}, "user_id": {"1"}}, nil)
+		pending := jsonMap(response)
+		It("responds 202 with the Location and the pending status", func() {
+			Expect(response.Code, ShouldEqual, http.StatusAccepted)
+			Expect(response.Header().Get("Location"), ShouldEqual, "/novels/4")
+			Expect(pending["status"], ShouldEqual, "pending")
+		})
+
+		time.Sleep(60 * time.Millisecond)
+		completed := jsonMap(serveWithHeaders(faker, "GET", "/novels/4", nil, nil))
+		It("completes the item after the delay", func() {
+			Expect(completed["status"], ShouldEqual, "completed")
+		})
+	})
+
+	Describ("CheckAsyncMeta", t, func() {
+		model := validUserModel()
+		model.Async = true
+		It("returns error without a status column", func() {
+			Expect(model.CheckAsyncMeta(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	body := `{"title": "Dune", "user_id": 1}`
+
+	Describ("PUT /books/:id of a missing item", t, func() {
+		Context("when upsert is false", func() {
+			response := serveJSON(faker, "PUT", "/books/10", body)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when upsert is true", func() {
+			faker.Routers["books"].Model.Upsert = true
+			response := serveJSON(faker, "PUT", "/books/10", body)
+			created := serveJSON(faker, "POST", "/books", `{"title": "Emma", "user_id": 1}`)
+			It("creates the item with the id", func() {
+				Expect(response.Code, ShouldEqual, http.StatusCreated)
+				Expect(jsonMap(response)["id"], ShouldEqual, float64(10))
+				Expect(jsonMap(created)["id"], ShouldEqual, float64(11))
+			})
+		})
+	})
+}
+
+func TestOnDelete(t *testing.T) {
+	Describ("DELETE /users/1 which has books", t, func() {
+		Context("when on_delete is restrict", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["users"].Model.OnDelete = RestrictOnDelete
+			response := serveWithHeaders(faker, "DELETE", "/users/1", nil, nil)
+			It("returns 409 and keeps the user", func() {
+				Expect(response.Code, ShouldEqual, http.StatusConflict)
+				Expect(faker.Routers["users"].Model.Has(1), ShouldBeTrue)
+			})
+		})
+
+		Context("when on_delete is orphan", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["users"].Model.OnDelete = OrphanOnDelete
+			response := serveWithHeaders(faker, "DELETE", "/users/1", nil, nil)
+			It("keeps the books", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
+				Expect(faker.Routers["users"].Model.Has(1), ShouldBeFalse)
+				Expect(faker.Routers["books"].Model.Has(1), ShouldBeTrue)
+			})
+		})
+
+		Context("when on_delete is cascade", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveWithHeaders(faker, "DELETE", "/users/1", nil, nil)
+			It("deletes the books", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
+				Expect(faker.Routers["books"].Model.Has(1), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestRouteName(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.Route = "people"
+	faker.Routers["users"].setRestRoutes()
+	faker.setHandlers()
+
+	Describ("users routed at /people", t, func() {
+		response := serveWithHeaders(faker, "GET", "/people/1", nil, nil)
+		It("serves the users", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(jsonMap(response)["name"], ShouldEqual, "Frank")
+		})
+
+		Context("when request a missing person", func() {
+			response := serveWithHeaders(faker, "GET", "/people/100", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestContentRange(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /books with ContentRange", t, func() {
+		Context("when ContentRange is false", func() {
+			response := serveWithHeaders(faker, "GET", "/books?limit=2", nil, nil)
+			It("responds no Content-Range", func() {
+				Expect(response.Header().Get("Content-Range"), ShouldEqual, "")
+			})
+		})
+
+		Context("when paginated", func() {
+			faker.ContentRange = true
+			response := serveWithHeaders(faker, "GET", "/books?offset=1&limit=1", nil, nil)
+			It("responds Content-Range", func() {
+				Expect(response.Header().Get("Content-Range"), ShouldEqual, "books 1-1/3")
+				Expect(response.Header().Get("Access-Control-Expose-Headers"), ShouldEqual, "Content-Range, Link")
+			})
+		})
+
+		Context("when not paginated", func() {
+			faker.ContentRange = true
+			response := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("responds no Content-Range", func() {
+				Expect(response.Header().Get("Content-Range"), ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestPaginationLinks(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /books with Link", t, func() {
+		Context("when paginated", func() {
+			response := serveWithHeaders(faker, "GET", "/books?offset=1&limit=1", nil, nil)
+			It("responds Link with first, prev, next and last", func() {
+				Expect(response.Header().Get("Link"), ShouldEqual,
+					`</books?limit=1&offset=0>; rel="first", </books?limit=1&offset=0>; rel="prev", `+
+						`</books?limit=1&offset=2>; rel="next", </books?limit=1&offset=2>; rel="last"`)
+				Expect(response.Header().Get("Access-Control-Expose-Headers"), ShouldEqual, "Link")
+			})
+		})
+
+		Context("when on the first page with other params", func() {
+			response := serveWithHeaders(faker, "GET", "/books?limit=2&user_id=1", nil, nil)
+			It("keeps the params and responds no prev", func() {
+				Expect(response.Header().Get("Link"), ShouldEqual,
+					`</books?limit=2&offset=0&user_id=1>; rel="first", </books?limit=2&offset=2&user_id=1>; rel="next", `+
+						`</books?limit=2&offset=2&user_id=1>; rel="last"`)
+			})
+		})
+
+		Context("when not paginated", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("responds no Link", func() {
+				Expect(response.Header().Get("Link"), ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestBeforeHook(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.SetBeforeHook(func(ctx *gin.Context) {
+		if ctx.Request.Header.Get("X-Tenant") == "" {
+			ctx.JSON(http.StatusUnauthorized, nil)
+			ctx.Abort()
+		}
+	})
+
+	Describ("SetBeforeHook", t, func() {
+		Context("when the hook aborts", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("returns the response of the hook", func() {
+				Expect(response.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Context("when the hook passes", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, map[string]string{"X-Tenant": "a"})
+			It("runs the handler", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestTenants(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.TenantHeader = "X-Tenant"
+	tenantA := map[string]string{"X-Tenant": "a"}
+	tenantB := map[string]string{"X-Tenant": "b"}
+	book := url.Values{"title": {"Dune"}, "user_id": {"1"}}
+
+	Describ("data partitioned by X-Tenant", t, func() {
+		createdA := serveWithHeaders(faker, "POST", "/books", book, tenantA)
+		createdB := serveWithHeaders(faker, "POST", "/books", book, tenantB)
+		It("creates items with the same id in every tenant", func() {
+			Expect(createdA.Code, ShouldEqual, http.StatusOK)
+			Expect(createdB.Code, ShouldEqual, http.StatusOK)
+			Expect(jsonMap(createdA)["id"], ShouldEqual, float64(4))
+			Expect(jsonMap(createdB)["id"], ShouldEqual, float64(4))
+		})
+
+		Context("when request without a tenant", func() {
+			response := serveWithHeaders(faker, "GET", "/books/4", nil, nil)
+			It("does not see the data of tenants", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+				Expect(faker.Stats()["books"], ShouldEqual, 3)
+			})
+		})
+
+		Context("when delete in a tenant", func() {
+			serveWithHeaders(faker, "DELETE", "/books/4", nil, tenantA)
+			response := serveWithHeaders(faker, "GET", "/books/4", nil, tenantB)
+			It("does not change other tenants", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	bookModel := faker.Routers["books"].Model
+	bookModel.Columns = append(bookModel.Columns, &Column{Name: "deleted", Type: "boolean"})
+	bookModel.SoftDelete = "deleted"
+
+	Describ("DELETE /books/1 with soft_delete", t, func() {
+		response := serveWithHeaders(faker, "DELETE", "/books/1", nil, nil)
+		It("marks the book as deleted", func() {
+			Expect(response.Code, ShouldEqual, http.StatusNoContent)
+			Expect(bookModel.Has(1), ShouldBeTrue)
+			Expect(len(jsonSlice(serveWithHeaders(faker, "GET", "/books", nil, nil))), ShouldEqual, 2)
+			Expect(serveWithHeaders(faker, "DELETE", "/books/1", nil, nil).Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Context("when show_deleted is false", func() {
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when show_deleted is true", func() {
+			bookModel.ShowDeleted = true
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+			bookModel.ShowDeleted = false
+			It("returns the book with the deleted flag", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["deleted"], ShouldEqual, true)
+			})
+		})
+	})
+}
+
+func TestColumnAlias(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	title, _ := faker.Routers["books"].Model.Column("title")
+	title.Alias = "book_title"
+
+	Describ("books with title aliased as book_title", t, func() {
+		response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+		It("responds the alias", func() {
+			Expect(jsonMap(response)["book_title"], ShouldEqual, "The Little Prince")
+			Expect(jsonMap(response)["title"], ShouldBeNil)
+		})
+
+		Context("when create with the alias", func() {
+			response := serveJSON(faker, "POST", "/books", `{"book_title": "Dune", "user_id": 1}`)
+			It("accepts it", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["book_title"], ShouldEqual, "Dune")
+			})
+		})
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.Templates = map[string]string{
+		"index": `{"data": {{json .Items}}, "page": {{json .Params.page}}}`,
+		"show":  `{"book": {"id": {{.Item.id}}, "title": {{json .Item.title}}}}`,
+	}
+
+	Describ("books with templates", t, func() {
+		Context("when GET /books", func() {
+			response := serveWithHeaders(faker, "GET", "/books?page=2", nil, nil)
+			It("responds the rendered template", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonMap(response)["data"].([]interface{})), ShouldEqual, 3)
+				Expect(jsonMap(response)["page"], ShouldEqual, "2")
+			})
+		})
+
+		Context("when GET /books/1", func() {
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+			It("responds the rendered template", func() {
+				book, _ := jsonMap(response)["book"].(map[string]interface{})
+				Expect(book["title"], ShouldEqual, "The Little Prince")
+			})
+		})
+
+		Context("when the action has no template", func() {
+			response := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			It("responds the default json", func() {
+				Expect(jsonMap(response)["title"], ShouldEqual, "Dune")
+			})
+		})
+	})
+}
+
+func TestConsistencyDelay(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.ConsistencyDelay = 50
+
+	Describ("books with consistency_delay_ms", t, func() {
+		Context("when an item is just created", func() {
+			created := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			path := fmt.Sprintf("/books/%v", jsonMap(created)["id"])
+			pendingShow := serveWithHeaders(faker, "GET", path, nil, nil)
+			pendingIndex := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			time.Sleep(60 * time.Millisecond)
+			show := serveWithHeaders(faker, "GET", path, nil, nil)
+			It("is invisible in the delay", func() {
+				Expect(pendingShow.Code, ShouldEqual, http.StatusNotFound)
+				Expect(len(jsonSlice(pendingIndex)), ShouldEqual, 3)
+				Expect(show.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when an item is just updated", func() {
+			serveJSON(faker, "PATCH", "/books/2", `{"title": "Emma"}`)
+			pendingShow := serveWithHeaders(faker, "GET", "/books/2", nil, nil)
+			time.Sleep(60 * time.Millisecond)
+			show := serveWithHeaders(faker, "GET", "/books/2", nil, nil)
+			It("responds the previous version in the delay", func() {
+				Expect(jsonMap(pendingShow)["title"], ShouldEqual, "Life of Pi")
+				Expect(jsonMap(show)["title"], ShouldEqual, "Emma")
+			})
+		})
+	})
+}
+
+func TestSeedProfiles(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.SeedProfiles = map[string][]map[string]interface{}{
+		"one": {{"id": float64(1), "title": "Dune", "user_id": float64(1)}},
+	}
+
+	Describ("X-Seed-Profile", t, func() {
+		Context("when the profile is empty", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, map[string]string{"X-Seed-Profile": "empty"})
+			It("sees no data", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 0)
+			})
+		})
+
+		Context("when the profile is declared", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, map[string]string{"X-Seed-Profile": "one"})
+			It("sees the seeds of the profile", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 1)
+				Expect(faker.Stats()["books"], ShouldEqual, 3)
+			})
+		})
+
+		Context("when the profile is unknown", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, map[string]string{"X-Seed-Profile": "two"})
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Context("when the seeds of the profile are wrong", func() {
+			faker.Routers["books"].Model.SeedProfiles["wrong"] = []map[string]interface{}{{"id": float64(1), "title": "Dune"}}
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, map[string]string{"X-Seed-Profile": "wrong"})
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestStatusColumn(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	bookModel := faker.Routers["books"].Model
+	bookModel.Columns = append(bookModel.Columns, &Column{Name: "simulate_status", Type: "number"})
+	bookModel.StatusColumn = "simulate_status"
+
+	Describ("books with status_column", t, func() {
+		created := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1, "simulate_status": 500}`)
+		path := fmt.Sprintf("/books/%v", jsonMap(created)["id"])
+
+		Context("when show the item with a status", func() {
+			response := serveWithHeaders(faker, "GET", path, nil, nil)
+			It("responds the status", func() {
+				Expect(response.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+
+		Context("when show the item with a status without body", func() {
+			created := serveJSON(faker, "POST", "/books", `{"title": "Emma", "user_id": 1, "simulate_status": 204}`)
+			response := serveWithHeaders(faker, "GET", fmt.Sprintf("/books/%v", jsonMap(created)["id"]), nil, nil)
+			It("responds the status without body", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
+				Expect(response.Body.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Context("when show an item without a status", func() {
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestTrailingSlash(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /users/", t, func() {
+		Context("when the mode is redirect", func() {
+			response := serveWithHeaders(faker, "GET", "/users/", nil, nil)
+			It("redirects", func() {
+				Expect(response.Code, ShouldEqual, http.StatusMovedPermanently)
+			})
+		})
+
+		Context("when the mode is ignore", func() {
+			faker.SetTrailingSlash(TrailingSlashIgnore)
+			response := serveWithHeaders(faker, "GET", "/users/", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when the mode is not_found", func() {
+			faker.SetTrailingSlash(TrailingSlashNotFound)
+			response := serveWithHeaders(faker, "GET", "/users/", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when the mode is unknown", func() {
+			It("returns error", func() {
+				Expect(faker.SetTrailingSlash("strict"), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestHeaders(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Headers = map[string]string{"Cache-Control": "max-age=60", "X-Api": "fake"}
+	faker.Routers["users"].Model.Headers = map[string]string{"Cache-Control": "no-store"}
+
+	Describ("response headers", t, func() {
+		Context("when the model has headers", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("overrides the default headers", func() {
+				Expect(response.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+				Expect(response.Header().Get("X-Api"), ShouldEqual, "fake")
+			})
+		})
+
+		Context("when the model has no headers", func() {
+			response := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("responds the default headers", func() {
+				Expect(response.Header().Get("Cache-Control"), ShouldEqual, "max-age=60")
+			})
+		})
+	})
+}
+
+func TestRequiredOn(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	bookModel := faker.Routers["books"].Model
+	userIdColumn, _ := bookModel.Column("user_id")
+	userIdColumn.RequiredOn = []string{CreateAction}
+
+	Describ("books with user_id required on create", t, func() {
+		Context("when PUT without user_id", func() {
+			response := serveJSON(faker, "PUT", "/books/2", `{"title": "Life of Pi 2"}`)
+			It("keeps the old value", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["user_id"], ShouldEqual, float64(2))
+				Expect(jsonMap(response)["title"], ShouldEqual, "Life of Pi 2")
+			})
+		})
+
+		Context("when POST without user_id", func() {
+			response := serveJSON(faker, "POST", "/books", `{"title": "Dune"}`)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	bookModel := faker.Routers["books"].Model
+
+	Describ("transactions", t, func() {
+		Context("when rollback", func() {
+			faker.Begin()
+			serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			serveJSON(faker, "PUT", "/books/2", `{"title": "Life of Pi 2", "user_id": 2}`)
+			serveWithHeaders(faker, "DELETE", "/books/3", nil, nil)
+			err := faker.Rollback()
+
+			It("restores the data, uniqueness and id", func() {
+				Expect(err, ShouldBeNil)
+				Expect(bookModel.Len(), ShouldEqual, 3)
+				li, _ := bookModel.Get(2)
+				Expect(li.dataMap["title"], ShouldEqual, "Life of Pi")
+				Expect(bookModel.Has(3), ShouldBeTrue)
+
+				faker.Begin()
+				created := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+				Expect(created.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(created)["id"], ShouldEqual, float64(4))
+				faker.Rollback()
+			})
+		})
+
+		Context("when commit", func() {
+			faker.Begin()
+			serveJSON(faker, "PUT", "/books/2", `{"title": "Life of Pi 3", "user_id": 2}`)
+			err := faker.Commit()
+
+			It("keeps the data", func() {
+				Expect(err, ShouldBeNil)
+				li, _ := bookModel.Get(2)
+				Expect(li.dataMap["title"], ShouldEqual, "Life of Pi 3")
+			})
+		})
+
+		Context("when there is no transaction", func() {
+			It("returns error", func() {
+				Expect(faker.Rollback(), ShouldNotBeNil)
+				Expect(faker.Commit(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestIdFormat(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.IdFormat = "USR-%05d"
+
+	Describ("users with id_format", t, func() {
+		Context("when GET with a formatted id", func() {
+			response := serveWithHeaders(faker, "GET", "/users/USR-00001", nil, nil)
+			It("responds the formatted id", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["id"], ShouldEqual, "USR-00001")
+			})
+		})
+
+		Context("when GET with a plain id", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestQuota(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("quota of 2 requests", t, func() {
+		faker.SetQuota(Quota{Limit: 2, Window: time.Hour, KeyHeader: "X-Api-Key"})
+		headers := map[string]string{"X-Api-Key": "a"}
+		first := serveWithHeaders(faker, "GET", "/users", nil, headers)
+		serveWithHeaders(faker, "GET", "/users", nil, headers)
+		exceeded := serveWithHeaders(faker, "GET", "/users", nil, headers)
+
+		It("counts the remaining requests", func() {
+			Expect(first.Code, ShouldEqual, http.StatusOK)
+			Expect(first.Header().Get("X-RateLimit-Remaining"), ShouldEqual, "1")
+		})
+
+		It("returns 429 after the quota is used up", func() {
+			Expect(exceeded.Code, ShouldEqual, http.StatusTooManyRequests)
+			Expect(exceeded.Header().Get("X-RateLimit-Remaining"), ShouldEqual, "0")
+		})
+
+		Context("when the request is from another client", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, map[string]string{"X-Api-Key": "b"})
+			It("has its own quota", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when the window resets", func() {
+			faker.SetQuota(Quota{Limit: 1, Window: 10 * time.Millisecond})
+			serveWithHeaders(faker, "GET", "/users", nil, nil)
+			time.Sleep(20 * time.Millisecond)
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("returns 200", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestDeterministic(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("deterministic mode", t, func() {
+		requestIDs := func() []string {
+			ids := []string{}
+			for i := 0; i < 2; i++ {
+				ids = append(ids, serveWithHeaders(faker, "GET", "/users", nil, nil).Header().Get("X-Request-ID"))
+			}
+			return ids
+		}
+		randomItems := func() interface{} {
+			return jsonSlice(serveWithHeaders(faker, "GET", "/books/random?n=3", nil, nil))
+		}
+
+		faker.SetDeterministic(true)
+		firstIDs, firstRandom := requestIDs(), randomItems()
+		faker.SetDeterministic(true)
+		secondIDs, secondRandom := requestIDs(), randomItems()
+
+		It("reproduces request ids and random items", func() {
+			Expect(faker.IsDeterministic(), ShouldBeTrue)
+			Expect(firstIDs[0], ShouldNotEqual, firstIDs[1])
+			Expect(secondIDs, ShouldResemble, firstIDs)
+			Expect(secondRandom, ShouldResemble, firstRandom)
+		})
+	})
+}
+
+func TestSetSeed(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("seeded random source", t, func() {
+		run := func(seed int64) (string, interface{}) {
+			faker.SetSeed(seed)
+			id := serveWithHeaders(faker, "GET", "/users", nil, nil).Header().Get("X-Request-ID")
+			return id, jsonSlice(serveWithHeaders(faker, "GET", "/books/random?n=3", nil, nil))
+		}
+
+		firstID, firstRandom := run(7)
+		secondID, secondRandom := run(7)
+		otherID, _ := run(8)
+
+		It("reproduces request ids and random items of the same seed", func() {
+			Expect(secondID, ShouldEqual, firstID)
+			Expect(secondRandom, ShouldResemble, firstRandom)
+			Expect(otherID, ShouldNotEqual, firstID)
+		})
+	})
+}
+
+func TestErrorFormat(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("error formats", t, func() {
+		Context("when the format is problem", func() {
+			faker.SetErrorFormat(ErrorFormatProblem)
+			response := serveWithHeaders(faker, "GET", "/users/x", nil, nil)
+			It("responds the problem details", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(response.Header().Get("Content-Type"), ShouldStartWith, "application/problem+json")
+				Expect(jsonMap(response)["status"], ShouldEqual, float64(http.StatusBadRequest))
+				Expect(jsonMap(response)["title"], ShouldEqual, "Bad Request")
+			})
+		})
+
+		Context("when an admin api gets a 400 in the problem format", func() {
+			response := serveWithHeaders(faker, "POST", "/admin/maintenance", url.Values{"status": {"maybe"}}, nil)
+			It("responds the problem details", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(response.Header().Get("Content-Type"), ShouldStartWith, "application/problem+json")
+				Expect(jsonMap(response)["detail"], ShouldEqual, "status must be on or off")
+			})
+		})
+
+		Context("when the format is jsonapi", func() {
+			faker.SetErrorFormat(ErrorFormatJSONAPI)
+			response := serveWithHeaders(faker, "GET", "/users/100", nil, nil)
+			It("responds the errors array", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+				errors, _ := jsonMap(response)["errors"].([]interface{})
+				Expect(len(errors), ShouldEqual, 1)
+				Expect(errors[0].(map[string]interface{})["status"], ShouldEqual, "404")
+			})
+		})
+
+		Context("when the format is rails", func() {
+			faker.SetErrorFormat(ErrorFormatRails)
+			response := serveJSON(faker, "POST", "/users", `{"name": "N"}`)
+			It("responds the errors object", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				errors, _ := jsonMap(response)["errors"].(map[string]interface{})
+				Expect(errors["base"], ShouldNotBeNil)
+			})
+		})
+
+		Context("when the format is unknown", func() {
+			It("returns error", func() {
+				Expect(faker.SetErrorFormat("xml"), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestAggregates(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.Aggregates = map[string]*Aggregate{
+		"stats":   {Column: "user_id"},
+		"by_user": {Column: "id", GroupBy: "user_id"},
+	}
+
+	Describ("GET /books/stats", t, func() {
+		response := serveWithHeaders(faker, "GET", "/books/stats", nil, nil)
+		It("responds the aggregate of all items", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			stats := jsonMap(response)
+			Expect(stats["count"], ShouldEqual, float64(3))
+			Expect(stats["sum"], ShouldEqual, float64(4))
+			Expect(stats["min"], ShouldEqual, float64(1))
+			Expect(stats["max"], ShouldEqual, float64(2))
+		})
+
+		Context("when filtered by a column", func() {
+			response := serveWithHeaders(faker, "GET", "/books/stats?user_id=1", nil, nil)
+			It("responds the aggregate of the filtered items", func() {
+				Expect(jsonMap(response)["count"], ShouldEqual, float64(2))
+			})
+		})
+
+		Context("when grouped by a column", func() {
+			response := serveWithHeaders(faker, "GET", "/books/by_user", nil, nil)
+			It("responds the aggregate of every group", func() {
+				groups := jsonMap(response)
+				Expect(groups["1"].(map[string]interface{})["sum"], ShouldEqual, float64(4))
+				Expect(groups["2"].(map[string]interface{})["count"], ShouldEqual, float64(1))
+			})
+		})
+	})
+}
+
+func TestRecording(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("recording mode", t, func() {
+		faker.ClearRecordedRequests()
+		serveWithHeaders(faker, "POST", "/admin/recording", url.Values{"status": {"on"}, "size": {"2"}}, nil)
+		serveWithHeaders(faker, "GET", "/users", nil, nil)
+		created := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+		serveWithHeaders(faker, "GET", "/books?limit=1", nil, map[string]string{"X-Request-ID": "last"})
+
+		response := serveWithHeaders(faker, "GET", "/admin/requests", nil, nil)
+		It("keeps the last requests of the size", func() {
+			records := jsonSlice(response)
+			Expect(len(records), ShouldEqual, 2)
+			first := records[0].(map[string]interface{})
+			Expect(first["method"], ShouldEqual, "POST")
+			Expect(first["body"], ShouldEqual, `{"title": "Dune", "user_id": 1}`)
+			last := records[1].(map[string]interface{})
+			Expect(last["query"], ShouldEqual, "limit=1")
+			Expect(last["request_id"], ShouldEqual, "last")
+		})
+
+		It("keeps the body for handlers", func() {
+			Expect(created.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Context("when turn off", func() {
+			serveWithHeaders(faker, "POST", "/admin/recording", url.Values{"status": {"off"}}, nil)
+			serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("stops recording", func() {
+				Expect(len(faker.RecordedRequests()), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestTransform(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	nameColumn, _ := faker.Routers["users"].Model.Column("name")
+	nameColumn.Transform = "trim,title"
+
+	Describ("POST /users with a transformed column", t, func() {
+		response := serveJSON(faker, "POST", "/users", `{"name": "  ameng LI ", "phone": "13213213219", "age": 22}`)
+		It("stores the transformed value", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(jsonMap(response)["name"], ShouldEqual, "Ameng Li")
+		})
+	})
+}
+
+func TestMergePatch(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	bookModel := faker.Routers["books"].Model
+	userIdColumn, _ := bookModel.Column("user_id")
+	userIdColumn.RequiredOn = []string{CreateAction}
+	bookModel.Columns = append(bookModel.Columns, &Column{Name: "meta", Type: "json", RequiredOn: []string{CreateAction}})
+	headers := map[string]string{"Content-Type": "application/merge-patch+json"}
+	mergePatch := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", path, strings.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		faker.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	Describ("PATCH /books/:id with application/merge-patch+json", t, func() {
+		Context("when a value is null", func() {
+			response := mergePatch("/books/1", `{"user_id": null, "meta": {"tags": ["kids"], "pages": 96}}`)
+			It("removes the column", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				_, ok := jsonMap(response)["user_id"]
+				Expect(ok, ShouldBeFalse)
+			})
+
+			Context("when patch a json column", func() {
+				response := mergePatch("/books/1", `{"meta": {"pages": null, "lang": "fr"}}`)
+				It("merges the object recursively", func() {
+					Expect(jsonMap(response)["meta"], ShouldResemble, map[string]interface{}{
+						"tags": []interface{}{"kids"}, "lang": "fr",
+					})
+				})
+			})
+		})
+
+		Context("when a required column is null", func() {
+			response := mergePatch("/books/2", `{"title": null}`)
+			It("returns 422", func() {
+				Expect(response.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+	})
+}
+
+func TestStaticRoutes(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("static routes", t, func() {
+		Context("when GET /config", func() {
+			response := serveWithHeaders(faker, "GET", "/config", nil, nil)
+			It("responds the fixed body", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["version"], ShouldEqual, "1.0")
+			})
+		})
+
+		Context("when POST /logout", func() {
+			response := serveWithHeaders(faker, "POST", "/logout", nil, nil)
+			It("responds the status", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNoContent)
+			})
+		})
+
+		Context("when GET /me aliasing the user of X-User-Id", func() {
+			response := serveWithHeaders(faker, "GET", "/me", nil, map[string]string{"X-User-Id": "2"})
+			missing := serveWithHeaders(faker, "GET", "/me", nil, nil)
+			It("responds the user", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["name"], ShouldEqual, "Antony")
+				Expect(missing.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when GET a path under the catch-all /legacy/*", func() {
+			response := serveWithHeaders(faker, "GET", "/legacy/a/b", nil, nil)
+			base := serveWithHeaders(faker, "GET", "/legacy", nil, nil)
+			specific := serveWithHeaders(faker, "GET", "/legacy/ping", nil, nil)
+			other := serveWithHeaders(faker, "POST", "/legacy/a", nil, nil)
+			It("responds the fixed body unless a specific route matches", func() {
+				Expect(response.Code, ShouldEqual, http.StatusGone)
+				Expect(jsonMap(response)["error"], ShouldEqual, "gone")
+				Expect(base.Code, ShouldEqual, http.StatusGone)
+				Expect(specific.Code, ShouldEqual, http.StatusOK)
+				Expect(other.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when GET /adults aliasing the filtered users", func() {
+			response := serveWithHeaders(faker, "GET", "/adults", nil, nil)
+			It("responds the matching users", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 3)
+			})
+		})
+
+		Context("when an alias filters an unknown column", func() {
+			faker.staticRoutes = []StaticRoute{{Method: "GET", Path: "/me", Alias: &RouteAlias{Resource: "users", Filter: map[string]interface{}{"email": "a@b.c"}}}}
+			It("returns error", func() {
+				Expect(faker.CheckStaticRoutes(), ShouldNotBeNil)
+			})
+		})
+
+		Context("when a static route is under a resource", func() {
+			faker.staticRoutes = []StaticRoute{{Method: "GET", Path: "/users/config"}}
+			It("returns error", func() {
+				Expect(faker.CheckStaticRoutes(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestNDJSON(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /books with Accept: application/x-ndjson", t, func() {
+		response := serveWithHeaders(faker, "GET", "/books", nil, map[string]string{"Accept": "application/x-ndjson"})
+		It("responds one json object per line", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(response.Header().Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+			lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+			Expect(len(lines), ShouldEqual, 3)
+			book := map[string]interface{}{}
+			json.Unmarshal([]byte(lines[0]), &book)
+			Expect(book["title"], ShouldEqual, "The Little Prince")
+		})
+	})
+}
+
+func TestMaxRecords(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.MaxRecords = 4
+
+	Describ("POST /books with max_records", t, func() {
+		first := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+		second := serveJSON(faker, "POST", "/books", `{"title": "Emma", "user_id": 1}`)
+		It("returns 507 when the model is full", func() {
+			Expect(first.Code, ShouldEqual, http.StatusOK)
+			Expect(second.Code, ShouldEqual, http.StatusInsufficientStorage)
+		})
+	})
+}
+
+func TestViews(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.Views = map[string][]string{"summary": {"name"}}
+
+	Describ("GET /users with view", t, func() {
+		Context("when the view is known", func() {
+			response := serveWithHeaders(faker, "GET", "/users?view=summary", nil, nil)
+			It("responds only id and the columns of the view", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonSlice(response)[0], ShouldResemble, map[string]interface{}{"id": float64(1), "name": "Frank"})
+			})
+		})
+
+		Context("when GET /users/:id with include", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1?view=summary&include=books", nil, nil)
+			It("keeps the included collections", func() {
+				user := jsonMap(response)
+				_, hasPhone := user["phone"]
+				Expect(hasPhone, ShouldBeFalse)
+				Expect(len(user["books"].([]interface{})), ShouldEqual, 2)
+			})
+		})
+
+		Context("when the view is unknown", func() {
+			response := serveWithHeaders(faker, "GET", "/users?view=full", nil, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("Start and Shutdown", t, func() {
+		err := faker.Start("localhost:0")
+		addr := faker.Addr()
+		response, getErr := http.Get("http://" + addr + "/users")
+
+		It("serves at the address", func() {
+			Expect(err, ShouldBeNil)
+			Expect(getErr, ShouldBeNil)
+			Expect(response.StatusCode, ShouldEqual, http.StatusOK)
+			response.Body.Close()
+		})
+
+		Context("when shutdown", func() {
+			shutdownErr := faker.Shutdown(context.Background(), false)
+			_, getErr := http.Get("http://" + addr + "/users")
+			It("stops serving", func() {
+				Expect(shutdownErr, ShouldBeNil)
+				Expect(getErr, ShouldNotBeNil)
+				Expect(faker.Addr(), ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestSingleton(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "apifaker_singleton")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/settings.json", []byte(`{
+		"resource_name": "settings",
+		"singleton": true,
+		"columns": [{"name": "id", "type": "number"}, {"name": "theme", "type": "string"}],
+		"seeds": [{"id": 1, "theme": "light"}]
+	}`), 0644)
+	faker, err := NewWithApiDir(dir)
+
+	Describ("singleton settings", t, func() {
+		It("loads the model", func() {
+			Expect(err, ShouldBeNil)
+		})
+
+		Context("when GET /settings", func() {
+			response := serveWithHeaders(faker, "GET", "/settings", nil, nil)
+			It("responds the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["theme"], ShouldEqual, "light")
+			})
+		})
+
+		Context("when PUT /settings", func() {
+			response := serveJSON(faker, "PUT", "/settings", `{"theme": "dark"}`)
+			It("updates the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(serveWithHeaders(faker, "GET", "/settings", nil, nil))["theme"], ShouldEqual, "dark")
+			})
+		})
+
+		Context("when GET /settings/1", func() {
+			response := serveWithHeaders(faker, "GET", "/settings/1", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("Validate", t, func() {
+		It("returns nil for the loaded fixtures", func() {
+			Expect(faker.Validate(), ShouldBeNil)
+		})
+
+		Context("when items point to missing items", func() {
+			bookModel := faker.Routers["books"].Model
+			bookModel.Set.Add(NewLineItemWithMap(map[string]interface{}{"id": float64(8), "title": "Dune", "user_id": float64(99)}))
+			bookModel.Set.Add(NewLineItemWithMap(map[string]interface{}{"id": float64(9), "title": "Emma", "user_id": float64(98)}))
+			err := faker.Validate()
+			It("lists all dangling references", func() {
+				references, ok := err.(DanglingReferencesError)
+				Expect(ok, ShouldBeTrue)
+				Expect(references.References, ShouldResemble, []string{
+					"books[id=8].user_id=99 points to no item of users",
+					"books[id=9].user_id=98 points to no item of users",
+				})
+			})
+		})
+	})
+}
+
+func TestOverrideHandler(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("OverrideHandler", t, func() {
+		err := faker.OverrideHandler("users", "POST", func(ctx *gin.Context, model *Model) {
+			ctx.JSON(http.StatusAccepted, map[string]interface{}{"count": model.Len()})
+		})
+
+		Context("when POST /users", func() {
+			response := serveWithHeaders(faker, "POST", "/users", url.Values{"name": {"Ameng"}}, nil)
+			It("uses the overriding handler", func() {
+				Expect(err, ShouldBeNil)
+				Expect(response.Code, ShouldEqual, http.StatusAccepted)
+				Expect(jsonMap(response)["count"], ShouldEqual, float64(3))
+			})
+		})
+
+		Context("when GET /users", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("uses the generated handler", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when the resource is unknown", func() {
+			It("returns error", func() {
+				Expect(faker.OverrideHandler("orders", "GET", nil), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestDelay(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.Delay = map[string]int{"POST": 50}
+
+	Describ("books with delay of POST", t, func() {
+		Context("when POST /books", func() {
+			start := time.Now()
+			response := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			It("waits for the delay", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			})
+		})
+
+		Context("when GET /books", func() {
+			start := time.Now()
+			serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("responds without the delay", func() {
+				Expect(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+			})
+		})
+	})
+}
+
+func TestVary(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.TenantHeader = "X-Tenant"
+
+	Describ("Vary header", t, func() {
+		Context("when GET /users", func() {
+			response := serveWithHeaders(faker, "GET", "/users", nil, nil)
+			It("varies by Accept, the tenant and the seed profile", func() {
+				Expect(response.Header().Get("Vary"), ShouldEqual, "X-Tenant, X-Seed-Profile, Accept")
+			})
+		})
+
+		Context("when GET /users/1", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("varies by the tenant and the seed profile", func() {
+				Expect(response.Header().Get("Vary"), ShouldEqual, "X-Tenant, X-Seed-Profile")
+			})
+		})
+
+		Context("when POST /users", func() {
+			response := serveJSON(faker, "POST", "/users", `{"name": "Ross", "phone": "12345678901", "age": 30}`)
+			It("has no Vary header", func() {
+				Expect(response.Header().Get("Vary"), ShouldEqual, "")
+			})
+		})
+	})
+}
+
+func TestInvalidId(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("ids in routes", t, func() {
+		Context("when the id is not an integer", func() {
+			for _, id := range []string{"abc", "1.5", "NaN"} {
+				response := serveWithHeaders(faker, "GET", "/users/"+id, nil, nil)
+				It("returns 400 of invalid id", func() {
+					Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+					Expect(jsonMap(response)["message"], ShouldContainSubstring, "invalid id")
+				})
+			}
+		})
+
+		Context("when the id is an integer without item", func() {
+			response := serveWithHeaders(faker, "DELETE", "/users/100", nil, nil)
+			It("returns 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestBulkCreate(t *testing.T) {
+	Describ("POST /books with a json array", t, func() {
+		Context("when all items are valid", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "POST", "/books", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 2}]`)
+			It("creates all of them", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 5)
+			})
+		})
+
+		Context("when an item is invalid", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "POST", "/books", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 100}]`)
+			It("creates none of them", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(jsonMap(response)["message"], ShouldStartWith, "item[1]")
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 3)
+			})
+		})
+
+		Context("when an item duplicates an existing item", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "POST", "/users", `[{"name": "Monica", "phone": "13213213240", "age": 21}, {"name": "Frank", "phone": "13213213241", "age": 21}]`)
+			It("creates none of them", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(jsonMap(response)["message"], ShouldStartWith, "item[1]")
+				Expect(faker.Routers["users"].Model.Len(), ShouldEqual, 3)
+			})
+		})
+
+		Context("when the collection is read at the same time", func() {
+			faker, _ := NewWithApiDir(testDir)
+			counts := make(chan int, 20)
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					counts <- len(jsonSlice(serveWithHeaders(faker, "GET", "/books", nil, nil)))
+				}()
+			}
+			response := serveJSON(faker, "POST", "/books", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 2}]`)
+			wg.Wait()
+			close(counts)
+			It("reads none or all of the new items", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				for count := range counts {
+					Expect(count == 3 || count == 5, ShouldBeTrue)
+				}
+			})
+		})
+
+		Context("when an item is invalid in best effort mode", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "POST", "/books?best_effort=true", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 100}]`)
+			results := jsonSlice(response)
+			It("creates the valid ones and responds 207 with every result", func() {
+				Expect(response.Code, ShouldEqual, http.StatusMultiStatus)
+				Expect(len(results), ShouldEqual, 2)
+				Expect(results[0].(map[string]interface{})["status"], ShouldEqual, float64(http.StatusOK))
+				Expect(results[1].(map[string]interface{})["status"], ShouldEqual, float64(http.StatusBadRequest))
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 4)
+			})
+		})
+	})
+}
+
+func TestFromHeader(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	books := faker.Routers["books"].Model
+	books.Columns = append(books.Columns, &Column{Name: "created_by", Type: "number", FromHeader: "X-User-Id", RequiredOn: []string{CreateAction}})
+
+	Describ("column from header", t, func() {
+		Context("when POST /books with the header", func() {
+			response := serveWithHeaders(faker, "POST", "/books", url.Values{"title": {"Dune"}, "user_id": {"1"}, "created_by": {"3"}}, map[string]string{"X-User-Id": "2"})
+			It("sets the column to the header value and ignores the body", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["created_by"], ShouldEqual, float64(2))
+			})
+		})
+
+		Context("when POST /books without the header", func() {
+			response := serveWithHeaders(faker, "POST", "/books", url.Values{"title": {"Emma"}, "user_id": {"1"}}, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestAddModel(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	newModel := func() *Model {
+		return &Model{
+			Name: "tags",
+			Columns: []*Column{
+				{Name: "id", Type: "number"},
+				{Name: "label", Type: "string", Unique: true},
+			},
+			Seeds: []map[string]interface{}{{"id": 1, "label": "go"}},
+		}
+	}
+
+	Describ("AddModel", t, func() {
+		Context("when the model is valid", func() {
+			err := faker.AddModel(newModel())
+			created := serveJSON(faker, "POST", "/tags", `{"label": "mock"}`)
+			response := serveWithHeaders(faker, "GET", "/tags", nil, nil)
+			It("registers the model and its routes", func() {
+				Expect(err, ShouldBeNil)
+				Expect(created.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				Expect(faker.Routers["tags"].SaveToFile(), ShouldNotBeNil)
+			})
+		})
+
+		Context("when the model has been existed", func() {
+			It("returns error", func() {
+				Expect(faker.AddModel(newModel()), ShouldNotBeNil)
+			})
+		})
+
+		Context("when the model is invalid", func() {
+			model := newModel()
+			model.Name = "labels"
+			model.Seeds = append(model.Seeds, map[string]interface{}{"id": float64(2), "label": "go"})
+			err := faker.AddModel(model)
+			It("returns error and registers nothing", func() {
+				Expect(err, ShouldNotBeNil)
+				_, ok := faker.Routers["labels"]
+				Expect(ok, ShouldBeFalse)
+				Expect(serveWithHeaders(faker, "GET", "/labels", nil, nil).Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when requests are served at the same time", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					serveWithHeaders(faker, "GET", "/users", nil, nil)
+				}()
+			}
+			model := newModel()
+			model.Name = "topics"
+			err := faker.AddModel(model)
+			wg.Wait()
+			response := serveWithHeaders(faker, "GET", "/topics", nil, nil)
+			It("registers the model", func() {
+				Expect(err, ShouldBeNil)
+				Expect(len(jsonSlice(response)), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestRequiredParams(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["users"].Model.RequiredParams = []string{"api_version"}
+
+	Describ("users with required params", t, func() {
+		Context("when the param is absent", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			It("returns 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(jsonMap(response)["message"], ShouldContainSubstring, "api_version")
+			})
+		})
+
+		Context("when the param is present", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1?api_version=2", nil, nil)
+			It("returns the user", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestGenerateChildren(t *testing.T) {
+	Describ("GenerateChildren", t, func() {
+		Context("when users generate books", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["users"].Model.GenerateChildren = map[string]ChildrenGenerator{"books": {Min: 2}}
+			err := faker.GenerateChildren()
+			response := serveWithHeaders(faker, "GET", "/users/3?include=books", nil, nil)
+			It("adds the children linked to every parent", func() {
+				Expect(err, ShouldBeNil)
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 9)
+				Expect(len(jsonMap(response)["books"].([]interface{})), ShouldEqual, 2)
+			})
+		})
+
+		Context("when the count is in a range", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["users"].Model.GenerateChildren = map[string]ChildrenGenerator{"books": {Min: 1, Max: 3}}
+			faker.SetSeed(42)
+			err := faker.GenerateChildren()
+			count := faker.Routers["books"].Model.Len() - 3
+			It("adds min to max children to every parent", func() {
+				Expect(err, ShouldBeNil)
+				Expect(count, ShouldBeGreaterThanOrEqualTo, 3)
+				Expect(count, ShouldBeLessThan, 10)
+			})
+		})
+
+		Context("when the child has no foreign key", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["books"].Model.GenerateChildren = map[string]ChildrenGenerator{"users": {Min: 1}}
+			It("returns error", func() {
+				Expect(faker.GenerateChildren(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestFieldOrder(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("field order of responses", t, func() {
+		Context("when GET /users/1", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			body := response.Body.String()
+			It("responds the fields in the order of columns", func() {
+				Expect(strings.Index(body, `"id"`) < strings.Index(body, `"name"`), ShouldBeTrue)
+				Expect(strings.Index(body, `"name"`) < strings.Index(body, `"phone"`), ShouldBeTrue)
+				Expect(strings.Index(body, `"phone"`) < strings.Index(body, `"age"`), ShouldBeTrue)
+			})
+		})
+
+		Context("when GET /books/1 with the related user", func() {
+			response := serveWithHeaders(faker, "GET", "/books/1", nil, nil)
+			body := response.Body.String()
+			It("responds the columns before other fields", func() {
+				Expect(strings.HasPrefix(body, `{"id":1,"title":"The Little Prince","user_id":1`), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	titleColumn, _ := faker.Routers["books"].Model.Column("title")
+	titleColumn.Description = "the title of the book"
+
+	Describ("GET /resources", t, func() {
+		response := serveWithHeaders(faker, "GET", "/resources", nil, nil)
+		resources := jsonSlice(response)
+		It("responds every resource sorted by name with its schema and count", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(len(resources), ShouldEqual, len(faker.Routers))
+			Expect(resources[0].(map[string]interface{})["name"], ShouldEqual, "avatars")
+
+			books := resources[1].(map[string]interface{})
+			Expect(books["name"], ShouldEqual, "books")
+			Expect(books["route"], ShouldEqual, "/books")
+			Expect(books["count"], ShouldEqual, float64(3))
+			Expect(len(books["actions"].([]interface{})), ShouldEqual, 5)
+			title := books["columns"].([]interface{})[1].(map[string]interface{})
+			Expect(title["name"], ShouldEqual, "title")
+			Expect(title["unique"], ShouldEqual, true)
+			Expect(title["description"], ShouldEqual, "the title of the book")
+		})
+	})
+}
+
+func TestMockErrorHeader(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	headers := map[string]string{"X-Mock-Error": "503"}
+
+	Describ("X-Mock-Error header", t, func() {
+		Context("when it is disabled", func() {
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, headers)
+			It("is ignored", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when it is enabled", func() {
+			faker.SetMockErrorHeader(true)
+			response := serveWithHeaders(faker, "GET", "/users/1", nil, headers)
+			other := serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			wrong := serveWithHeaders(faker, "GET", "/users/1", nil, map[string]string{"X-Mock-Error": "200"})
+			It("forces the status of the request only", func() {
+				Expect(response.Code, ShouldEqual, http.StatusServiceUnavailable)
+				Expect(jsonMap(response)["message"], ShouldContainSubstring, "Service Unavailable")
+				Expect(other.Code, ShouldEqual, http.StatusOK)
+				Expect(wrong.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestUniqueTogether(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	err := faker.AddModel(&Model{
+		Name: "people",
+		Columns: []*Column{
+			{Name: "id", Type: "number"},
+			{Name: "first_name", Type: "string"},
+			{Name: "last_name", Type: "string"},
+		},
+		UniqueTogether: [][]string{{"first_name", "last_name"}},
+		Seeds: []map[string]interface{}{
+			{"id": 1, "first_name": "Ross", "last_name": "Geller"},
+			{"id": 2, "first_name": "Monica", "last_name": "Geller"},
+		},
+	})
+
+	Describ("unique_together", t, func() {
+		It("accepts seeds unique together", func() {
+			Expect(err, ShouldBeNil)
+		})
+
+		Context("when POST a duplicated combination", func() {
+			response := serveJSON(faker, "POST", "/people", `{"first_name": "Ross", "last_name": "Geller"}`)
+			It("returns 409", func() {
+				Expect(response.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Context("when POST a new combination", func() {
+			response := serveJSON(faker, "POST", "/people", `{"first_name": "Ross", "last_name": "Gellar"}`)
+			It("creates the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when PATCH to a duplicated combination", func() {
+			response := serveJSON(faker, "PATCH", "/people/2", `{"first_name": "Ross"}`)
+			It("returns 409 and keeps the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusConflict)
+				li, _ := faker.Routers["people"].Model.Get(2)
+				Expect(li.ToMap()["first_name"], ShouldEqual, "Monica")
+			})
+		})
+
+		Context("when PUT the item with its own combination", func() {
+			response := serveJSON(faker, "PUT", "/people/1", `{"first_name": "Ross", "last_name": "Geller"}`)
+			It("updates the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestValidationLogger(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	buf := &bytes.Buffer{}
+	faker.SetValidationLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	Describ("validation logger", t, func() {
+		Context("when POST /books with a wrong value", func() {
+			response := serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 100}`)
+			record := map[string]interface{}{}
+			json.Unmarshal(buf.Bytes(), &record)
+			It("logs the failure with the resource, field and reason", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(record["level"], ShouldEqual, "WARN")
+				Expect(record["resource"], ShouldEqual, "books")
+				Expect(record["field"], ShouldEqual, "user_id")
+				Expect(record["reason"], ShouldEqual, jsonMap(response)["message"])
+				Expect(response.Header().Get("X-Request-ID"), ShouldNotEqual, "")
+				Expect(record["request_id"], ShouldEqual, response.Header().Get("X-Request-ID"))
+			})
+		})
+
+		Context("when POST /books without a column", func() {
+			buf.Reset()
+			response := serveJSON(faker, "POST", "/books", `{"title": "Dune"}`)
+			record := map[string]interface{}{}
+			json.Unmarshal(buf.Bytes(), &record)
+			It("logs the missing column as the field", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(record["field"], ShouldEqual, "user_id")
+			})
+		})
+
+		Context("when GET gets a 400", func() {
+			buf.Reset()
+			serveWithHeaders(faker, "GET", "/books?limit=x", nil, nil)
+			It("logs nothing", func() {
+				Expect(buf.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestBlob(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.AddModel(&Model{
+		Name: "media",
+		Columns: []*Column{
+			{Name: "id", Type: "number"},
+			{Name: "content", Type: "blob"},
+		},
+		// "0123456789"
+		Seeds: []map[string]interface{}{{"id": 1, "content": "MDEyMzQ1Njc4OQ=="}},
+	})
+
+	Describ("GET /media/:id/content", t, func() {
+		Context("when get the whole blob", func() {
+			response := serveWithHeaders(faker, "GET", "/media/1/content", nil, nil)
+			It("responds the decoded bytes", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(response.Body.String(), ShouldEqual, "0123456789")
+				Expect(response.Header().Get("Accept-Ranges"), ShouldEqual, "bytes")
+			})
+		})
+
+		Context("when get a range", func() {
+			response := serveWithHeaders(faker, "GET", "/media/1/content", nil, map[string]string{"Range": "bytes=2-5"})
+			It("responds 206 with the range", func() {
+				Expect(response.Code, ShouldEqual, http.StatusPartialContent)
+				Expect(response.Body.String(), ShouldEqual, "2345")
+				Expect(response.Header().Get("Content-Range"), ShouldEqual, "bytes 2-5/10")
+			})
+		})
+
+		Context("when the range is not satisfiable", func() {
+			response := serveWithHeaders(faker, "GET", "/media/1/content", nil, map[string]string{"Range": "bytes=20-30"})
+			It("responds 416", func() {
+				Expect(response.Code, ShouldEqual, http.StatusRequestedRangeNotSatisfiable)
+			})
+		})
+
+		Context("when the item is missing", func() {
+			response := serveWithHeaders(faker, "GET", "/media/2/content", nil, nil)
+			It("responds 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when create with a wrong base64 value", func() {
+			response := serveJSON(faker, "POST", "/media", `{"content": "not base64!"}`)
+			It("responds 422", func() {
+				Expect(response.Code, ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+	})
+}
+
+func TestExportCSV(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /users.csv", t, func() {
+		response := serveWithHeaders(faker, "GET", "/users.csv", nil, nil)
+		It("responds the items as csv", func() {
+			Expect(response.Code, ShouldEqual, http.StatusOK)
+			Expect(response.Header().Get("Content-Type"), ShouldStartWith, "text/csv")
+			Expect(response.Body.String(), ShouldStartWith, "id,name,phone,age\n1,Frank,13213213213,22\n")
+		})
+	})
+}
+
+func TestCreateWithId(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("POST /users with id", t, func() {
+		Context("when the id is new", func() {
+			response := serveJSON(faker, "POST", "/users", `{"id": 10, "name": "Ameng", "phone": "13213213214", "age": 22}`)
+			next := serveJSON(faker, "POST", "/users", `{"name": "Bob", "phone": "13213213215", "age": 22}`)
+			It("creates the item with the id", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonMap(response)["id"], ShouldEqual, 10)
+				Expect(jsonMap(next)["id"], ShouldEqual, 11)
+			})
+		})
+
+		Context("when the id exists", func() {
+			response := serveJSON(faker, "POST", "/users", `{"id": 1, "name": "Cindy", "phone": "13213213216", "age": 22}`)
+			It("responds 409 and keeps the item", func() {
+				Expect(response.Code, ShouldEqual, http.StatusConflict)
+				Expect(jsonMap(serveWithHeaders(faker, "GET", "/users/1", nil, nil))["name"], ShouldEqual, "Frank")
+			})
+		})
+
+		Context("when the id is not a positive integer", func() {
+			response := serveJSON(faker, "POST", "/users", `{"id": 1.5, "name": "Cindy", "phone": "13213213216", "age": 22}`)
+			It("responds 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestBodyLogging(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	buf := &bytes.Buffer{}
+	faker.SetBodyLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+
+	Describ("body logging", t, func() {
+		Context("when it is off", func() {
+			serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			It("logs nothing", func() {
+				Expect(buf.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Context("when it is turned on by POST /admin/body_logging", func() {
+			response := serveWithHeaders(faker, "POST", "/admin/body_logging", url.Values{"resource": {"books"}, "status": {"on"}}, nil)
+			created := serveJSON(faker, "POST", "/books", `{"title": "Emma", "user_id": 1}`)
+			serveWithHeaders(faker, "GET", "/users/1", nil, nil)
+			record := map[string]interface{}{}
+			json.Unmarshal(buf.Bytes(), &record)
+			It("logs the bodies of the resource only", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(record["resource"], ShouldEqual, "books")
+				Expect(record["status"], ShouldEqual, 200)
+				Expect(record["request_body"], ShouldEqual, `{"title": "Emma", "user_id": 1}`)
+				Expect(record["response_body"], ShouldEqual, created.Body.String())
+				Expect(created.Header().Get("X-Request-ID"), ShouldNotEqual, "")
+				Expect(record["request_id"], ShouldEqual, created.Header().Get("X-Request-ID"))
+				Expect(strings.Count(buf.String(), "\n"), ShouldEqual, 1)
+			})
+		})
+
+		Context("when it is turned off", func() {
+			serveWithHeaders(faker, "POST", "/admin/body_logging", url.Values{"resource": {"books"}, "status": {"off"}}, nil)
+			buf.Reset()
+			serveJSON(faker, "POST", "/books", `{"title": "Ulysses", "user_id": 1}`)
+			It("stops logging", func() {
+				Expect(buf.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Context("when the resource is unknown", func() {
+			response := serveWithHeaders(faker, "POST", "/admin/body_logging", url.Values{"resource": {"nothing"}, "status": {"on"}}, nil)
+			It("responds 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when a model is added at the same time", func() {
+			done := make(chan *httptest.ResponseRecorder)
+			go func() {
+				done <- serveWithHeaders(faker, "POST", "/admin/body_logging", url.Values{"resource": {"users"}, "status": {"off"}}, nil)
+			}()
+			err := faker.AddModel(&Model{Name: "tags", Columns: []*Column{{Name: "id", Type: "number"}}})
+			response := <-done
+			It("responds the resource", func() {
+				Expect(err, ShouldBeNil)
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
+
+func TestGoneOnDelete(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET a deleted item", t, func() {
+		Context("when GoneOnDelete is false", func() {
+			serveWithHeaders(faker, "DELETE", "/books/3", nil, nil)
+			response := serveWithHeaders(faker, "GET", "/books/3", nil, nil)
+			It("responds 404", func() {
+				Expect(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when GoneOnDelete is true", func() {
+			faker.Routers["books"].Model.GoneOnDelete = true
+			serveWithHeaders(faker, "DELETE", "/books/2", nil, nil)
+			response := serveWithHeaders(faker, "GET", "/books/2", nil, nil)
+			missing := serveWithHeaders(faker, "GET", "/books/100", nil, nil)
+			It("responds 410 for the deleted item and 404 for the missing one", func() {
+				Expect(response.Code, ShouldEqual, http.StatusGone)
+				Expect(serveWithHeaders(faker, "DELETE", "/books/2", nil, nil).Code, ShouldEqual, http.StatusGone)
+				Expect(missing.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestReplaceAll(t *testing.T) {
+	Describ("PUT /books with a json array", t, func() {
+		Context("when all items are valid", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "PUT", "/books", `[{"id": 10, "title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 2}]`)
+			It("replaces all items", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				Expect(jsonSlice(response)[0].(map[string]interface{})["id"], ShouldEqual, 10)
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 2)
+				Expect(serveWithHeaders(faker, "GET", "/books/1", nil, nil).Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Context("when an item is invalid", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "PUT", "/books", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 100}]`)
+			It("changes nothing", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(jsonMap(response)["message"], ShouldStartWith, "item[1]")
+				Expect(faker.Routers["books"].Model.Len(), ShouldEqual, 3)
+				Expect(serveWithHeaders(faker, "GET", "/books/1", nil, nil).Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Context("when an item is invalid after a pending write", func() {
+			faker, _ := NewWithApiDir(testDir)
+			faker.Routers["books"].Model.ConsistencyDelay = 60000
+			serveJSON(faker, "POST", "/books", `{"title": "Dune", "user_id": 1}`)
+			serveJSON(faker, "PUT", "/books", `[{"title": "Emma", "user_id": 100}]`)
+			response := serveWithHeaders(faker, "GET", "/books", nil, nil)
+			It("keeps the pending write invisible", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 3)
+			})
+		})
+
+		Context("when the collection is read at the same time", func() {
+			faker, _ := NewWithApiDir(testDir)
+			counts := make(chan int, 20)
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					counts <- len(jsonSlice(serveWithHeaders(faker, "GET", "/books", nil, nil)))
+				}()
+			}
+			response := serveJSON(faker, "PUT", "/books", `[{"title": "Dune", "user_id": 1}, {"title": "Emma", "user_id": 2}]`)
+			wg.Wait()
+			close(counts)
+			It("reads all old items or all new ones", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				for count := range counts {
+					Expect(count == 3 || count == 2, ShouldBeTrue)
+				}
+			})
+		})
+
+		Context("when the body is not an array", func() {
+			faker, _ := NewWithApiDir(testDir)
+			response := serveJSON(faker, "PUT", "/books", `{"title": "Dune", "user_id": 1}`)
+			It("responds 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestSortAndFields(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+
+	Describ("GET /books with sort and fields", t, func() {
+		Context("when they are right", func() {
+			response := serveWithHeaders(faker, "GET", "/books?sort=-user_id&fields=user_id", nil, nil)
+			It("sorts the items by the columns and then id", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(jsonSlice(response), ShouldResemble, []interface{}{
+					map[string]interface{}{"id": float64(2), "user_id": float64(2)},
+					map[string]interface{}{"id": float64(1), "user_id": float64(1)},
+					map[string]interface{}{"id": float64(3), "user_id": float64(1)},
+				})
+			})
+		})
+
+		Context("when a column is unknown", func() {
+			response := serveWithHeaders(faker, "GET", "/books?sort=nothing", nil, nil)
+			It("responds 400", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestMaxLimit(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	faker.Routers["books"].Model.MaxLimit = 2
+
+	Describ("GET /books with max_limit", t, func() {
+		Context("when the limit is bigger", func() {
+			response := serveWithHeaders(faker, "GET", "/books?limit=1000000", nil, nil)
+			It("clamps the limit down", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				Expect(response.Header().Get("X-Limit-Clamped"), ShouldEqual, "2")
+			})
+		})
+
+		Context("when all items are asked", func() {
+			response := serveWithHeaders(faker, "GET", "/books?all=true", nil, nil)
+			It("clamps the limit down", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 2)
+				Expect(response.Header().Get("X-Limit-Clamped"), ShouldEqual, "2")
+			})
+		})
+
+		Context("when the limit is not bigger", func() {
+			response := serveWithHeaders(faker, "GET", "/books?limit=1", nil, nil)
+			It("keeps the limit", func() {
+				Expect(len(jsonSlice(response)), ShouldEqual, 1)
+				Expect(response.Header().Get("X-Limit-Clamped"), ShouldEqual, "")
+			})
+		})
+	})
+}
+
+// copyingStorage keeps copies of the LineItems like a storage out of memory, Add fails if fail is true
+type copyingStorage struct {
+	Storage
+	fail bool
+}
+
+func (storage *copyingStorage) Get(id float64) (LineItem, bool) {
+	li, ok := storage.Storage.Get(id)
+	return NewLineItemWithMap(li.ToMap()), ok
+}
+
+func (storage *copyingStorage) Add(li LineItem) error {
+	if storage.fail {
+		return fmt.Errorf("storage is down")
+	}
+	return storage.Storage.Add(NewLineItemWithMap(li.ToMap()))
+}
+
+func TestStorageWrites(t *testing.T) {
+	faker, _ := NewWithApiDir(testDir)
+	storage := &copyingStorage{Storage: NewMemoryStorage()}
+	faker.Routers["users"].Model.SetStorage(storage)
+
+	Describ("writes of a storage out of memory", t, func() {
+		Context("when PATCH", func() {
+			response := serveJSON(faker, "PATCH", "/users/1", `{"name": "Ross"}`)
+			li, _ := storage.Get(1)
+			It("writes the change into the storage", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(li.ToMap()["name"], ShouldEqual, "Ross")
+				Expect(faker.Routers["users"].Model.dataChanged, ShouldBeTrue)
+			})
+		})
+
+		Context("when PATCH two items to the same unique value at once", func() {
+			codes := make(chan int, 2)
+			var wg sync.WaitGroup
+			for _, id := range []string{"2", "3"} {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					codes <- serveJSON(faker, "PATCH", "/users/"+id, `{"name": "Chandler"}`).Code
+				}(id)
+			}
+			wg.Wait()
+			close(codes)
+			succeeded := 0
+			for code := range codes {
+				if code == http.StatusOK {
+					succeeded++
+				}
+			}
+			It("updates only one of them", func() {
+				Expect(succeeded, ShouldEqual, 1)
+			})
+		})
+
+		Context("when PATCH with a merge patch", func() {
+			req, _ := http.NewRequest("PATCH", "/users/1", strings.NewReader(`{"name": "Joey"}`))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			response := httptest.NewRecorder()
+			faker.ServeHTTP(response, req)
+			li, _ := storage.Get(1)
+			It("writes the change into the storage", func() {
+				Expect(response.Code, ShouldEqual, http.StatusOK)
+				Expect(li.ToMap()["name"], ShouldEqual, "Joey")
+			})
+		})
+
+		Context("when the storage fails", func() {
+			storage.fail = true
+			response := serveJSON(faker, "POST", "/users", `{"name": "Monica", "phone": "12332132132", "age": 21}`)
+			storage.fail = false
+			It("responds the error", func() {
+				Expect(response.Code, ShouldEqual, http.StatusBadRequest)
+				Expect(jsonMap(response)["message"], ShouldEqual, "storage is down")
+			})
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package apifaker
+
+import (
+	"time"
+)
+
+const (
+	// asyncPending the status of an async item before it is completed
+	asyncPending = "pending"
+
+	// asyncCompleted the status of an async item after AsyncDelay
+	asyncCompleted = "completed"
+)
+
+// CheckAsyncMeta checks if an async Model has a string column named status and a non-negative AsyncDelay
+func (model *Model) CheckAsyncMeta() error {
+	if !model.Async {
+		return nil
+	}
+
+	if model.AsyncDelay < 0 {
+		return JsonFileErrorf("async_delay_ms of model[name=\"%s\"] can not be negative in file: %s", model.Name, model.router.filePath)
+	}
+
+	if column, ok := model.Column("status"); !ok || column.Type != str.Name() {
+		return JsonFileErrorf("async model[name=\"%s\"] must have a string column status in file: %s", model.Name, model.router.filePath)
+	}
+	return nil
+}
+
+// isAsyncStatus returns if the column is the status of an async Model, which could be omitted on create
+func (model *Model) isAsyncStatus(column *Column) bool {
+	return model.Async && column.Name == "status"
+}
+
+// AddAsync adds the LineItem with the status "pending",
+// the status turns "completed" after AsyncDelay milliseconds in the background
+func (model *Model) AddAsync(li LineItem) error {
+	li.Set("status", asyncPending)
+	if err := model.Add(li); err != nil {
+		return err
+	}
+
+	id := li.ID()
+	time.AfterFunc(time.Duration(model.AsyncDelay)*time.Millisecond, func() {
+		model.complete(id)
+	})
+	return nil
+}
+
+// complete sets the status of the LineItem with the given id "completed" if it still exists
+func (model *Model) complete(id float64) {
+	model.Lock()
+	defer model.Unlock()
+
+	li, ok := model.Get(id)
+	if !ok {
+		return
+	}
+
+	completed := NewLineItemWithMap(li.ToMap())
+	completed.Set("status", asyncCompleted)
+	// it stays pending if the Storage fails
+	if err := model.Set.Add(completed); err != nil {
+		return
+	}
+	model.dataChanged = true
+}
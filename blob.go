@@ -0,0 +1,52 @@
+package apifaker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blobAction the action of GET /collection/:id/<column> of a blob column, it is allowed with the show action
+const blobAction = "blob"
+
+// blobColumns returns the columns of type blob
+func (model *Model) blobColumns() []*Column {
+	columns := []*Column{}
+	for _, column := range model.Columns {
+		if column.Type == blob.Name() {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// blob handles GET /collection/:id/<column>, responds the decoded bytes of the blob column of the item,
+// the Range header is honored with a 206 Partial Content, Content-Type is sniffed from the bytes,
+// responds 404 if the item has no value of the column
+func (af *ApiFaker) blob(ctx *gin.Context, model *Model, columnName string) {
+	id, _ := ctx.Get("idFloat64")
+	li, _ := model.Get(id.(float64))
+	li, ok := model.visible(li)
+	if !ok {
+		af.respondError(ctx, http.StatusNotFound, nil)
+		return
+	}
+
+	value, _ := li.Get(columnName)
+	valueStr, ok := value.(string)
+	if !ok {
+		af.respondError(ctx, http.StatusNotFound, nil)
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(valueStr)
+	if err != nil {
+		af.respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the zero time of an item without "updated_at" is ignored
+	lastModified, _ := model.LastModified(li)
+	http.ServeContent(ctx.Writer, ctx.Request, columnName, lastModified, bytes.NewReader(data))
+}
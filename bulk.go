@@ -0,0 +1,160 @@
+package apifaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BulkResult is the result of an item created by POST /collection with a json array in best effort mode
+type BulkResult struct {
+	// Status the status code the item would get if it were created alone
+	Status int `json:"status"`
+
+	// Body the created item or the error
+	Body interface{} `json:"body"`
+}
+
+// jsonArrayBody returns the json array of objects in the request body and if the body is an array,
+// the body is kept for other readers if it is not an array
+func jsonArrayBody(ctx *gin.Context) ([]map[string]interface{}, bool, error) {
+	if mediaType(ctx) != "application/json" {
+		return nil, false, nil
+	}
+
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return nil, false, ParamsErrorf("wrong json body: %v", err)
+	}
+	ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		return nil, false, nil
+	}
+
+	items := []map[string]interface{}{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, true, ParamsErrorf("wrong json array body: %v", err)
+	}
+	return items, true, nil
+}
+
+// bulkCreate handles POST /collection with a json array of items,
+// all of them are created or none by default, the first failed item gets the response of its error,
+// the items are checked in a fresh Model first, then added at once, so readers never see a part of them,
+// query param "best_effort=true" creates the valid ones and responds 207 with a BulkResult of every item
+func (af *ApiFaker) bulkCreate(ctx *gin.Context, model *Model, items []map[string]interface{}) {
+	if ctx.Query("best_effort") == "true" {
+		af.bulkCreateBestEffort(ctx, model, items)
+		return
+	}
+
+	// the fresh Model has the same meta, an empty Storage and empty unique values
+	staged, err := model.clone(model.router, emptySeedProfile)
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	model.RLock()
+	staged.currentId = model.currentId
+	model.RUnlock()
+
+	for i, item := range items {
+		// every item is read as the json body by NewLineItemWithGinContext
+		ctx.Set("jsonBody", item)
+		li, err := NewLineItemWithGinContext(ctx, staged)
+		if err == nil {
+			err = staged.Add(li)
+		}
+		if err != nil {
+			af.respondError(ctx, ErrorStatus(err), fmt.Errorf("item[%d]: %v", i, err))
+			return
+		}
+	}
+
+	created := staged.lineItems()
+	if i, err := model.addLineItems(created); err != nil {
+		af.respondError(ctx, ErrorStatus(err), fmt.Errorf("item[%d]: %v", i, err))
+		return
+	}
+	for _, li := range created {
+		model.setPending(li.ID(), nil)
+	}
+	af.respond(ctx, http.StatusOK, model.orderedJSON(model.RenderSlice(created)))
+}
+
+// bulkCreateBestEffort creates the valid items of POST /collection?best_effort=true one by one,
+// responds 207 with a BulkResult of every item
+func (af *ApiFaker) bulkCreateBestEffort(ctx *gin.Context, model *Model, items []map[string]interface{}) {
+	results := []BulkResult{}
+	for _, item := range items {
+		// every item is read as the json body by NewLineItemWithGinContext
+		ctx.Set("jsonBody", item)
+		li, err := NewLineItemWithGinContext(ctx, model)
+		if err == nil {
+			err = model.Add(li)
+		}
+		if err != nil {
+			results = append(results, BulkResult{Status: ErrorStatus(err), Body: ResponseErrorMsg(err)})
+			continue
+		}
+		model.setPending(li.ID(), nil)
+		results = append(results, BulkResult{Status: http.StatusOK, Body: model.ordered(model.Render(li))})
+	}
+	af.respond(ctx, http.StatusMultiStatus, results)
+}
+
+// replaceAction the action of PUT /collection replacing all items, it is allowed with the update action
+const replaceAction = "replace"
+
+// replaceAll handles PUT /collection with a json array of items,
+// all items are replaced by the new ones if every one is valid, otherwise nothing is changed,
+// the first failed item gets the response of its error, the related data of the removed items are kept,
+// the items are checked in a fresh Model first, readers of the collection see all old items or all new ones
+func (af *ApiFaker) replaceAll(ctx *gin.Context, model *Model) {
+	if !af.checkContentType(ctx, model) {
+		return
+	}
+
+	items, ok, err := jsonArrayBody(ctx)
+	if err == nil && !ok {
+		err = ParamsErrorf("PUT /%s needs a json array", model.RouteName())
+	}
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+
+	// the fresh Model has the same meta, an empty Storage and empty unique values
+	staged, err := model.clone(model.router, emptySeedProfile)
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	model.RLock()
+	staged.currentId = model.currentId
+	model.RUnlock()
+
+	for i, item := range items {
+		// every item is read as the json body by NewLineItemWithGinContext
+		ctx.Set("jsonBody", item)
+		li, err := NewLineItemWithGinContext(ctx, staged)
+		if err == nil {
+			err = staged.Add(li)
+		}
+		if err != nil {
+			af.respondError(ctx, ErrorStatus(err), fmt.Errorf("item[%d]: %v", i, err))
+			return
+		}
+	}
+
+	created := staged.lineItems()
+	if err := model.replaceLineItems(created); err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	af.respond(ctx, http.StatusOK, model.orderedJSON(model.RenderSlice(created)))
+}
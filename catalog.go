@@ -0,0 +1,87 @@
+package apifaker
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// catalogPath the path of the catalog of all resources
+const catalogPath = "/resources"
+
+// Resource describes a resource in the catalog responded by GET /resources
+type Resource struct {
+	// Name the resource name
+	Name string `json:"name"`
+
+	// Route the path of the resource routes including Prefix, e.g. "/users"
+	Route string `json:"route"`
+
+	// Singleton signs the resource is routed without id
+	Singleton bool `json:"singleton,omitempty"`
+
+	// Actions the enabled actions
+	Actions []string `json:"actions"`
+
+	// Columns the columns with their types and constraints
+	Columns []*Column `json:"columns"`
+
+	// Count the count of items
+	Count int `json:"count"`
+}
+
+// Catalog returns the Resource of every model sorted by name
+func (af *ApiFaker) Catalog() []Resource {
+	routers := af.routers()
+	names := []string{}
+	for name := range routers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resources := []Resource{}
+	for _, name := range names {
+		model := routers[name].Model
+		actions := []string{}
+		for _, action := range allActions {
+			if model.Allows(action) {
+				actions = append(actions, action)
+			}
+		}
+
+		resources = append(resources, Resource{
+			Name:      name,
+			Route:     af.Prefix + "/" + model.RouteName(),
+			Singleton: model.Singleton,
+			Actions:   actions,
+			Columns:   model.Columns,
+			Count:     model.Len(),
+		})
+	}
+	return resources
+}
+
+// setCatalogHandler sets the handler of GET /resources responding Catalog,
+// it is not set if a resource or a static route uses the path
+func (af *ApiFaker) setCatalogHandler(engine *gin.Engine) {
+	routeName := strings.TrimPrefix(catalogPath, "/")
+	if _, ok := af.routerByRouteName(routeName); ok {
+		return
+	}
+	for _, route := range af.staticRoutes {
+		if strings.Split(strings.TrimPrefix(route.Path, "/"), "/")[0] == routeName {
+			return
+		}
+	}
+
+	engine.GET(af.Prefix+catalogPath, func(ctx *gin.Context) {
+		scoped, err := af.scoped(ctx)
+		if err != nil {
+			af.respondError(ctx, ErrorStatus(err), err)
+			return
+		}
+		af.respond(ctx, http.StatusOK, scoped.Catalog())
+	})
+}
@@ -1,12 +1,19 @@
 package apifaker
 
 import (
+	"encoding/base64"
 	"fmt"
 	. "github.com/Focinfi/gset"
 	"github.com/jinzhu/inflection"
+	"math/big"
+	"net/mail"
+	"net/url"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type JsonType string
@@ -17,6 +24,28 @@ const (
 	str     JsonType = "string"
 	array   JsonType = "array"
 	object  JsonType = "object"
+
+	// date and datetime are strings in the layout of Column.Format
+	date     JsonType = "date"
+	datetime JsonType = "datetime"
+
+	// rawJSON accepts any json value, it is stored and responded as it is
+	rawJSON JsonType = "json"
+
+	// decimal is a string of a number with Column.Scale decimal places, e.g. "12.50"
+	decimal JsonType = "decimal"
+
+	// email is a string of an email address, it is trimmed and lowercased on write
+	email JsonType = "email"
+
+	// url is a string of an absolute url with a scheme and a host
+	urlType JsonType = "url"
+
+	// uuid is a string of an uuid in the canonical form, e.g. "123e4567-e89b-12d3-a456-426614174000"
+	uuid JsonType = "uuid"
+
+	// blob is a string of base64 encoded bytes, served by GET /collection/:id/<column> with Range support
+	blob JsonType = "blob"
 )
 
 // Name returns JsonType string itself
@@ -31,25 +60,76 @@ func (j JsonType) GoType() string {
 		return "bool"
 	case number:
 		return "float64"
-	case str:
+	case str, date, datetime, decimal, email, urlType, uuid, blob:
 		return "string"
 	case array:
 		return "[]interface {}"
 	case object:
 		return "map[string]interface {}"
+	case rawJSON:
+		return "interface {}"
 	}
 	return "nil"
 }
 
 // jsonTypes contains a list a supportted json types
-var jsonTypes = NewSetSimple(boolean, number, str, array, object)
+var jsonTypes = NewSetSimple(boolean, number, str, array, object, date, datetime, rawJSON, decimal, email, urlType, uuid, blob)
+
+// decimalPattern matches the string of a decimal
+var decimalPattern = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+
+// uuidPattern matches the string of an uuid
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 
 type Column struct {
 	Name          string `json:"name"`
 	Type          string `json:"type"`
 	Unique        bool   `json:"unique"`
 	RegexpPattern string `json:"regexp_pattern"`
-	uniqueValues  *SetThreadSafe
+
+	// Description the documentation of the column responded in the catalog of GET /resources, it is ignored by validation
+	Description string `json:"description,omitempty"`
+
+	// Example an example value of the column responded in the catalog and used by generated items, it is ignored by validation
+	Example interface{} `json:"example,omitempty"`
+
+	// UniqueCI makes the column unique, strings are compared case-insensitively
+	UniqueCI bool `json:"unique_ci,omitempty"`
+
+	// Transform the names of transforms normalizing a string value on write, separated by commas,
+	// e.g. "trim,lower", built-in ones are trim, lower, upper and title, see ApiFaker.RegisterTransform for custom ones
+	Transform string `json:"transform,omitempty"`
+
+	// Hidden signs the column is accepted and validated but never responded
+	Hidden bool `json:"hidden,omitempty"`
+
+	// Slugify the name of the source column, this column will be set to a url-safe slug of it on create,
+	// a numeric suffix is appended if the column is unique and the slug has been used
+	Slugify string `json:"slugify,omitempty"`
+
+	// FromHeader the name of the request header whose value is set to this column on create,
+	// e.g. "X-User-Id" for an audit column like "created_by", the value in the request body is ignored
+	FromHeader string `json:"from_header,omitempty"`
+
+	// Precision the max count of digits of a decimal column, 0 means no limit
+	Precision int `json:"precision,omitempty"`
+
+	// Scale the count of decimal places of a decimal column, values are rounded to it
+	Scale int `json:"scale,omitempty"`
+
+	// RequiredOn the actions of "create" and "update"(PUT) which require this column in the request body,
+	// empty means all, an absent value keeps the old one on update
+	RequiredOn []string `json:"required_on,omitempty"`
+
+	// Alias the key of this column in responses and request bodies, e.g. store "user_name" as "username",
+	// the name is still accepted in request bodies
+	Alias string `json:"alias,omitempty"`
+
+	// Format the time layout for date and datetime column,
+	// defaults are "2006-01-02" and time.RFC3339
+	Format string `json:"format,omitempty"`
+
+	uniqueValues *SetThreadSafe
 }
 
 func (column *Column) getUniqueValues() *SetThreadSafe {
@@ -59,10 +139,61 @@ func (column *Column) getUniqueValues() *SetThreadSafe {
 	return column.uniqueValues
 }
 
+// IsRequiredOn returns if the column is required in the request body of the given action
+func (column *Column) IsRequiredOn(action string) bool {
+	if len(column.RequiredOn) == 0 {
+		return true
+	}
+
+	for _, requiredAction := range column.RequiredOn {
+		if requiredAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// IsServerManaged returns if the column value is set by apifaker instead of the request body
+func (column *Column) IsServerManaged() bool {
+	return column.Slugify != "" || column.FromHeader != ""
+}
+
+// TimeLayout returns the layout for parsing and formatting the date or datetime value
+func (column *Column) TimeLayout() string {
+	if column.Format != "" {
+		return column.Format
+	}
+	if column.Type == datetime.Name() {
+		return time.RFC3339
+	}
+	return "2006-01-02"
+}
+
+// IsTime returns if the column is a date or datetime column
+func (column *Column) IsTime() bool {
+	return column.Type == date.Name() || column.Type == datetime.Name()
+}
+
+// ParseTime parses the given value using TimeLayout,
+// the values are kept as formatted strings so that they are the same after SaveToFile,
+// ok will be false if the value is not a string or has a wrong format
+func (column *Column) ParseTime(value interface{}) (t time.Time, ok bool) {
+	valueStr, ok := value.(string)
+	if !ok {
+		return
+	}
+
+	t, err := time.Parse(column.TimeLayout(), valueStr)
+	return t, err == nil
+}
+
 // CheckType checks
 //   1. Name and Type must be present
 //   2. Type must in jsonTypes
-//   3. RegexpPattern must valid
+//   3. json column can not be unique
+//   4. RequiredOn only contains create and update
+//   5. Precision and Scale must be non-negative, Scale can not be bigger than Precision
+//   6. RegexpPattern must valid
 func (column Column) CheckMeta() error {
 	if column.Name == "" {
 		return ColumnsErrorf("colmun[content=%v] must has a name", column)
@@ -77,6 +208,20 @@ func (column Column) CheckMeta() error {
 		return ColumnsErrorf("%s use unsupportted type: %s, all supportted types: %v", columnLogName, column.Type, jsonTypes.ToSlice())
 	}
 
+	if column.Type == rawJSON.Name() && column.IsUnique() {
+		return ColumnsErrorf("%s can not be unique for its type is %s", columnLogName, column.Type)
+	}
+
+	for _, action := range column.RequiredOn {
+		if action != CreateAction && action != UpdateAction {
+			return ColumnsErrorf("%s has unknown required_on action: %s", columnLogName, action)
+		}
+	}
+
+	if column.Precision < 0 || column.Scale < 0 || (column.Precision > 0 && column.Scale > column.Precision) {
+		return ColumnsErrorf("%s has wrong precision %d or scale %d", columnLogName, column.Precision, column.Scale)
+	}
+
 	if column.RegexpPattern != "" {
 		if _, err := regexp.Compile(column.RegexpPattern); err != nil {
 			return ColumnsErrorf("%s has wrong regexp pattern format: %s, error: %v", columnLogName, column.RegexpPattern)
@@ -95,24 +240,30 @@ func (column *Column) CheckRelationships(seedVal interface{}, model *Model) erro
 	columnLogName := fmt.Sprintf("column[name=\"%s\"]", column.Name)
 	resName := strings.TrimSuffix(column.Name, "_id")
 	resPluralName := inflection.Plural(resName)
-	router, ok := model.router.apiFaker.Routers[resPluralName]
+	router, ok := model.relatedRouters()[resPluralName]
 	if ok {
-		for _, li := range router.Model.ToLineItems() {
-			id, ok := li.Get("id")
-			if ok && id == seedVal {
-				return nil
-			}
+		if _, found := router.Model.FindBy("id", seedVal); found {
+			return nil
 		}
 	}
 
-	return ColumnsErrorf("%s has no item[id=%v] of resource[resource_name=\"%s\"]", columnLogName, seedVal, resPluralName)
+	return withField(column.Name, ColumnsErrorf("%s has no item[id=%v] of resource[resource_name=\"%s\"]", columnLogName, seedVal, resPluralName))
 }
 
-// CheckValue checks the value to insert database
+// CheckValue checks the value to insert database, the returned error is a FieldError of the column
 //   1. type
 //   2. regexp pattern matching
 //   3. uniqueness if unique is true
 func (column *Column) CheckValue(seedVal interface{}, model *Model) error {
+	return withField(column.Name, column.checkValue(seedVal, model))
+}
+
+func (column *Column) checkValue(seedVal interface{}, model *Model) error {
+	// any json value is valid for a json column
+	if column.Type == rawJSON.Name() {
+		return nil
+	}
+
 	columnLogName := fmt.Sprintf("column[name=\"%s\"]", column.Name)
 	goType := JsonType(column.Type).GoType()
 	jsonType := JsonType(column.Type).Name()
@@ -121,6 +272,40 @@ func (column *Column) CheckValue(seedVal interface{}, model *Model) error {
 		return ColumnsErrorf("%s has wrong type, expect a %s, but use a %s", columnLogName, jsonType, seedType)
 	}
 
+	if column.IsTime() {
+		if _, ok := column.ParseTime(seedVal); !ok {
+			return UnprocessableErrorf("%s has wrong %s format, value: %v, format: %s", columnLogName, column.Type, seedVal, column.TimeLayout())
+		}
+	}
+
+	if column.Type == decimal.Name() {
+		if err := column.checkDecimal(seedVal.(string)); err != nil {
+			return err
+		}
+	}
+
+	if column.Type == email.Name() {
+		if address, err := mail.ParseAddress(seedVal.(string)); err != nil || address.Address != seedVal {
+			return UnprocessableErrorf("%s has wrong email value: %v", columnLogName, seedVal)
+		}
+	}
+
+	if column.Type == urlType.Name() {
+		if u, err := url.ParseRequestURI(seedVal.(string)); err != nil || u.Scheme == "" || u.Host == "" {
+			return UnprocessableErrorf("%s has wrong url value: %v", columnLogName, seedVal)
+		}
+	}
+
+	if column.Type == uuid.Name() && !uuidPattern.MatchString(seedVal.(string)) {
+		return UnprocessableErrorf("%s has wrong uuid value: %v", columnLogName, seedVal)
+	}
+
+	if column.Type == blob.Name() {
+		if _, err := base64.StdEncoding.DecodeString(seedVal.(string)); err != nil {
+			return UnprocessableErrorf("%s has wrong base64 value: %v", columnLogName, seedVal)
+		}
+	}
+
 	if column.RegexpPattern != "" && column.Type == str.Name() {
 		matched, err := regexp.Match(column.RegexpPattern, []byte(seedVal.(string)))
 		if err == nil && !matched {
@@ -135,29 +320,127 @@ func (column *Column) CheckValue(seedVal interface{}, model *Model) error {
 	return nil
 }
 
+// Normalize returns the value in the canonical form of the column,
+// a string is transformed by Transform first, a decimal is a string with Scale decimal places,
+// an email is trimmed and lowercased, other values are returned as they are,
+// the custom transforms of the ApiFaker of the model are available unless model is nil
+func (column *Column) Normalize(value interface{}, model *Model) (interface{}, error) {
+	if valueStr, ok := value.(string); ok && column.Transform != "" {
+		value = column.transform(valueStr, model)
+	}
+
+	if valueStr, ok := value.(string); ok && column.Type == email.Name() {
+		return strings.ToLower(strings.TrimSpace(valueStr)), nil
+	}
+
+	if column.Type != decimal.Name() {
+		return value, nil
+	}
+
+	var valueStr string
+	switch v := value.(type) {
+	case float64:
+		valueStr = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		valueStr = v
+	default:
+		// the wrong type is reported by CheckValue
+		return value, nil
+	}
+
+	rat, ok := new(big.Rat).SetString(valueStr)
+	if !ok || !decimalPattern.MatchString(valueStr) {
+		return nil, withField(column.Name, UnprocessableErrorf("column[name=\"%s\"] has wrong decimal value: %v", column.Name, value))
+	}
+	return rat.FloatString(column.Scale), nil
+}
+
+// checkDecimal checks if the decimal string has at most Scale decimal places and Precision digits
+func (column *Column) checkDecimal(value string) error {
+	columnLogName := fmt.Sprintf("column[name=\"%s\"]", column.Name)
+	if !decimalPattern.MatchString(value) {
+		return UnprocessableErrorf("%s has wrong decimal value: %s", columnLogName, value)
+	}
+
+	parts := strings.SplitN(strings.TrimLeft(value, "+-"), ".", 2)
+	intDigits := len(strings.TrimLeft(parts[0], "0"))
+	scale := 0
+	if len(parts) == 2 {
+		scale = len(parts[1])
+	}
+
+	if scale > column.Scale || (column.Precision > 0 && intDigits > column.Precision-column.Scale) {
+		return UnprocessableErrorf("%s exceeds precision %d and scale %d, value: %s", columnLogName, column.Precision, column.Scale, value)
+	}
+	return nil
+}
+
+// IsUnique returns if the column should be unique, case-sensitively or not
+func (column *Column) IsUnique() bool {
+	return column.Unique || column.UniqueCI
+}
+
+// uniqueKey returns the key of the value in uniqueValues,
+// strings are lowercased if UniqueCI is true
+func (column *Column) uniqueKey(value interface{}) T {
+	if valueStr, ok := value.(string); ok && column.UniqueCI {
+		return T(strings.ToLower(valueStr))
+	}
+	return T(value)
+}
+
 // CheckUniquenessOf checks if the given value exists
 func (column *Column) CheckUniquenessOf(value interface{}) bool {
-	if !column.Unique || column.Name == "id" {
+	if !column.IsUnique() || column.Name == "id" {
 		return true
 	}
 
-	return !column.getUniqueValues().Has(T(value))
+	return !column.getUniqueValues().Has(column.uniqueKey(value))
 }
 
 // AddValue add the give value into the Column's uniqueValues
 func (column *Column) AddUniquenessOf(value interface{}) {
-	if !column.Unique {
+	if !column.IsUnique() {
 		return
 	}
 
-	column.getUniqueValues().Add(T(value))
+	column.getUniqueValues().Add(column.uniqueKey(value))
 }
 
 // RemoveValue remove the given value from Column's uniqueValues
 func (column *Column) RemoveUniquenessOf(value interface{}) {
-	if !column.Unique {
+	if !column.IsUnique() {
 		return
 	}
 
-	column.getUniqueValues().Remove(T(value))
+	column.getUniqueValues().Remove(column.uniqueKey(value))
+}
+
+// slugify returns a url-safe slug of the given string, e.g. "Hello World" -> "hello-world"
+func slugify(s string) string {
+	slug := []rune{}
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && len(slug) > 0 {
+				slug = append(slug, '-')
+			}
+			slug = append(slug, r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return string(slug)
+}
+
+// nextSlug returns a slug of the given source which is not used by the column
+func (column *Column) nextSlug(source interface{}) string {
+	sourceStr, _ := source.(string)
+	base := slugify(sourceStr)
+	slug := base
+	for i := 2; !column.CheckUniquenessOf(slug); i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	return slug
 }
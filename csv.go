@@ -0,0 +1,78 @@
+package apifaker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csvAction the action of GET /collection.csv, it is allowed with the index action
+const csvAction = "csv"
+
+// ExportCSV writes the LineItems of the Model sorted by id as csv,
+// the header row is the names of Columns, values are stringified by their column types
+func (model *Model) ExportCSV(w io.Writer) error {
+	model.RLock()
+	defer model.RUnlock()
+
+	return model.writeCSV(w, model.lineItems())
+}
+
+// writeCSV writes the given LineItems as csv with a header row of the names of Columns
+func (model *Model) writeCSV(w io.Writer, lis LineItems) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(model.Columns))
+	for i, column := range model.Columns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, li := range lis {
+		record := make([]string, len(model.Columns))
+		for i, column := range model.Columns {
+			value, _ := li.Get(column.Name)
+			record[i] = csvValue(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvValue returns the string form of the value in a csv cell,
+// null is empty, a number has no exponent, an array or object is in json
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	bytes, _ := json.Marshal(value)
+	return string(bytes)
+}
+
+// exportCSV handles GET /collection.csv, responds the visible items sorted by id as csv
+func (af *ApiFaker) exportCSV(ctx *gin.Context, model *Model) {
+	lis := model.visibleLineItems()
+	sort.Sort(lis)
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	if err := model.writeCSV(ctx.Writer, lis); err != nil {
+		ctx.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package apifaker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formats of error responses, e.g. the 4xx responses of wrong requests
+const (
+	// ErrorFormatDefault responds {"message": "..."}, it is the default format
+	ErrorFormatDefault = "default"
+
+	// ErrorFormatJSONAPI responds the errors array of JSON:API, {"errors": [{"status": "422", "title": "...", "detail": "..."}]}
+	ErrorFormatJSONAPI = "jsonapi"
+
+	// ErrorFormatProblem responds the problem details of RFC 7807 with Content-Type application/problem+json
+	ErrorFormatProblem = "problem"
+
+	// ErrorFormatRails responds the errors of Rails, {"errors": {"base": ["..."]}}
+	ErrorFormatRails = "rails"
+)
+
+// SetErrorFormat sets the format of error responses to match the error contract of clients,
+// it returns an error for an unknown format
+func (af *ApiFaker) SetErrorFormat(format string) error {
+	switch format {
+	case ErrorFormatDefault, ErrorFormatJSONAPI, ErrorFormatProblem, ErrorFormatRails:
+	default:
+		return fmt.Errorf("unknown error format: %s", format)
+	}
+
+	af.Lock()
+	defer af.Unlock()
+
+	af.errorFormat = format
+	return nil
+}
+
+// respondError responds the error in the error format of af and logs it if it is a validation failure,
+// a nil error responds an empty body in the default format, or the status text in other formats
+func (af *ApiFaker) respondError(ctx *gin.Context, code int, err error) {
+	af.logValidationFailure(ctx, code, err)
+
+	af.RLock()
+	format := af.errorFormat
+	af.RUnlock()
+
+	if format == "" || format == ErrorFormatDefault {
+		if err == nil {
+			af.respond(ctx, code, nil)
+		} else {
+			af.respond(ctx, code, ResponseErrorMsg(err))
+		}
+		return
+	}
+
+	detail := http.StatusText(code)
+	if err != nil {
+		detail = err.Error()
+	}
+
+	switch format {
+	case ErrorFormatJSONAPI:
+		ctx.Header("Content-Type", "application/vnd.api+json")
+		af.respond(ctx, code, map[string]interface{}{
+			"errors": []map[string]string{{
+				"status": strconv.Itoa(code),
+				"title":  http.StatusText(code),
+				"detail": detail,
+			}},
+		})
+	case ErrorFormatProblem:
+		ctx.Header("Content-Type", "application/problem+json")
+		af.respond(ctx, code, map[string]interface{}{
+			"type":   "about:blank",
+			"title":  http.StatusText(code),
+			"status": code,
+			"detail": detail,
+		})
+	case ErrorFormatRails:
+		af.respond(ctx, code, map[string]interface{}{
+			"errors": map[string][]string{"base": {detail}},
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package apifaker
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
 func JsonFileErrorf(format string, a ...interface{}) error {
@@ -24,6 +27,112 @@ func SeedsErrorf(format string, a ...interface{}) error {
 	return fmt.Errorf("Error [apifaker-seeds]: "+format, a...)
 }
 
+func QueryErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("Error [apifaker-query]: "+format, a...)
+}
+
+func ParamsErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("Error [apifaker-params]: "+format, a...)
+}
+
+func TransactionErrorf(format string, a ...interface{}) error {
+	return fmt.Errorf("Error [apifaker-transaction]: "+format, a...)
+}
+
+// MediaTypeError is for the request whose Content-Type is not accepted, handlers respond it with 415
+type MediaTypeError struct {
+	error
+}
+
+func MediaTypeErrorf(format string, a ...interface{}) error {
+	return MediaTypeError{fmt.Errorf("Error [apifaker-content_type]: "+format, a...)}
+}
+
+// UnprocessableError is for the value which has a right json type but can not be accepted,
+// e.g. a malformed date, handlers respond it with 422
+type UnprocessableError struct {
+	error
+}
+
+func UnprocessableErrorf(format string, a ...interface{}) error {
+	return UnprocessableError{fmt.Errorf("Error [apifaker-value]: "+format, a...)}
+}
+
+// ConflictError is for the request which conflicts with the current data,
+// e.g. deleting an item still referenced, handlers respond it with 409
+type ConflictError struct {
+	error
+}
+
+func ConflictErrorf(format string, a ...interface{}) error {
+	return ConflictError{fmt.Errorf("Error [apifaker-conflict]: "+format, a...)}
+}
+
+// NotFoundError is for the item which does not exist, handlers respond it with 404
+type NotFoundError struct {
+	error
+}
+
+func NotFoundErrorf(format string, a ...interface{}) error {
+	return NotFoundError{fmt.Errorf("Error [apifaker-not_found]: "+format, a...)}
+}
+
+// InsufficientStorageError is for the item which can not be added for the model is full,
+// handlers respond it with 507
+type InsufficientStorageError struct {
+	error
+}
+
+func InsufficientStorageErrorf(format string, a ...interface{}) error {
+	return InsufficientStorageError{fmt.Errorf("Error [apifaker-storage]: "+format, a...)}
+}
+
+// FieldError is the error of the value of a column, Field is the name of the column,
+// it wraps the error deciding the status code
+type FieldError struct {
+	Field string
+	error
+}
+
+func (err FieldError) Unwrap() error {
+	return err.error
+}
+
+// withField returns a FieldError of the given field wrapping err, or nil if err is nil
+func withField(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return FieldError{Field: field, error: err}
+}
+
+// DanglingReferencesError lists the foreign key values pointing to no item, returned by ApiFaker.Validate
+type DanglingReferencesError struct {
+	// References e.g. "books[id=4].user_id=9 points to no item of users"
+	References []string
+}
+
+func (err DanglingReferencesError) Error() string {
+	return fmt.Sprintf("Error [apifaker-references]: %d dangling references: %s", len(err.References), strings.Join(err.References, "; "))
+}
+
+// ErrorStatus returns the http status code which handlers respond for the given error
+func ErrorStatus(err error) int {
+	switch {
+	case errors.As(err, new(UnprocessableError)):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, new(MediaTypeError)):
+		return http.StatusUnsupportedMediaType
+	case errors.As(err, new(ConflictError)):
+		return http.StatusConflict
+	case errors.As(err, new(InsufficientStorageError)):
+		return http.StatusInsufficientStorage
+	case errors.As(err, new(NotFoundError)):
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
 func ResponseErrorMsg(err error) map[string]string {
 	return map[string]string{"message": err.Error()}
 }
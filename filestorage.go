@@ -0,0 +1,245 @@
+package apifaker
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// fileSpan is the position of an item in the file of a fileStorage
+type fileSpan struct {
+	offset int64
+	length int
+}
+
+// fileStorage is the Storage reading its items lazily from a JSON Lines file,
+// only the index of the file, the written items and at most hotSize recently read items are kept in memory,
+// the file is never changed, writes are kept in memory over it
+type fileStorage struct {
+	path    string
+	index   map[float64]fileSpan
+	written map[float64]LineItem
+	removed map[float64]bool
+
+	// hot items read from the file, the most recently used first
+	hotSize int
+	hot     map[float64]*list.Element
+	recent  *list.List
+
+	sync.Mutex
+}
+
+// hotItem is an element of fileStorage.recent
+type hotItem struct {
+	id float64
+	li LineItem
+}
+
+// NewFileStorage allocates and returns a new Storage of the items in the JSON Lines file of the given path,
+// every line is an item with a number id, e.g. {"id": 1, "name": "Frank"},
+// the file is indexed by ids at once but the items are read when they are used,
+// at most hotSize recently read items are kept in memory, writes are kept in memory and never change the file,
+// it backs a Model with seeds_file or could be set by Model.SetStorage for a resource with a very large dataset
+func NewFileStorage(path string, hotSize int) (Storage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	storage := &fileStorage{
+		path:    path,
+		index:   map[float64]fileSpan{},
+		written: map[float64]LineItem{},
+		removed: map[float64]bool{},
+		hotSize: hotSize,
+		hot:     map[float64]*list.Element{},
+		recent:  list.New(),
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		span := fileSpan{offset: offset, length: len(line)}
+		offset += int64(len(line))
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var item struct {
+				Id *float64 `json:"id"`
+			}
+			if err := json.Unmarshal(line, &item); err != nil || item.Id == nil {
+				return nil, SeedsErrorf("line %d of %s is not an item with a number id", lineNo, path)
+			}
+			if _, ok := storage.index[*item.Id]; ok {
+				return nil, SeedsErrorf("line %d of %s has a duplicated id: %v", lineNo, path, *item.Id)
+			}
+			storage.index[*item.Id] = span
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	return storage, nil
+}
+
+// Get implements Storage
+func (storage *fileStorage) Get(id float64) (LineItem, bool) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if li, ok := storage.written[id]; ok {
+		return li, true
+	}
+	if element, ok := storage.hot[id]; ok {
+		storage.recent.MoveToFront(element)
+		return element.Value.(hotItem).li, true
+	}
+
+	li, ok := storage.read(id)
+	if ok && storage.hotSize > 0 {
+		storage.hot[id] = storage.recent.PushFront(hotItem{id: id, li: li})
+		if storage.recent.Len() > storage.hotSize {
+			oldest := storage.recent.Back()
+			storage.recent.Remove(oldest)
+			delete(storage.hot, oldest.Value.(hotItem).id)
+		}
+	}
+	return li, ok
+}
+
+// Add implements Storage
+func (storage *fileStorage) Add(li LineItem) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	id := li.ID()
+	storage.forget(id)
+	delete(storage.removed, id)
+	storage.written[id] = li
+	return nil
+}
+
+// Remove implements Storage
+func (storage *fileStorage) Remove(id float64) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	storage.forget(id)
+	delete(storage.written, id)
+	if _, ok := storage.index[id]; ok {
+		storage.removed[id] = true
+	}
+	return nil
+}
+
+// Has implements Storage
+func (storage *fileStorage) Has(id float64) bool {
+	storage.Lock()
+	defer storage.Unlock()
+
+	if _, ok := storage.written[id]; ok {
+		return true
+	}
+	_, ok := storage.index[id]
+	return ok && !storage.removed[id]
+}
+
+// Len implements Storage
+func (storage *fileStorage) Len() int {
+	storage.Lock()
+	defer storage.Unlock()
+
+	count := len(storage.index) - len(storage.removed)
+	for id := range storage.written {
+		if _, ok := storage.index[id]; !ok {
+			count++
+		}
+	}
+	return count
+}
+
+// Iterate implements Storage, the file is read line by line and its items are not kept
+func (storage *fileStorage) Iterate(f func(li LineItem) bool) {
+	storage.Lock()
+	written := make(map[float64]LineItem, len(storage.written))
+	for id, li := range storage.written {
+		written[id] = li
+	}
+	removed := make(map[float64]bool, len(storage.removed))
+	for id := range storage.removed {
+		removed[id] = true
+	}
+	storage.Unlock()
+
+	if file, err := os.Open(storage.path); err == nil {
+		defer file.Close()
+
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			dataMap := map[string]interface{}{}
+			if json.Unmarshal(line, &dataMap) == nil {
+				id, _ := dataMap["id"].(float64)
+				li, ok := written[id]
+				if ok {
+					delete(written, id)
+				} else {
+					li, ok = NewLineItemWithMap(dataMap), !removed[id]
+				}
+				if ok && !f(li) {
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	for _, li := range written {
+		if !f(li) {
+			return
+		}
+	}
+}
+
+// read reads the item with the given id from the file, it is false if the id is not indexed or the item can not be read
+func (storage *fileStorage) read(id float64) (LineItem, bool) {
+	span, ok := storage.index[id]
+	if !ok || storage.removed[id] {
+		return LineItem{}, false
+	}
+
+	file, err := os.Open(storage.path)
+	if err != nil {
+		return LineItem{}, false
+	}
+	defer file.Close()
+
+	line := make([]byte, span.length)
+	if _, err := file.ReadAt(line, span.offset); err != nil {
+		return LineItem{}, false
+	}
+	dataMap := map[string]interface{}{}
+	if err := json.Unmarshal(line, &dataMap); err != nil {
+		return LineItem{}, false
+	}
+	return NewLineItemWithMap(dataMap), true
+}
+
+// forget removes the item with the given id from the hot items
+func (storage *fileStorage) forget(id float64) {
+	if element, ok := storage.hot[id]; ok {
+		storage.recent.Remove(element)
+		delete(storage.hot, id)
+	}
+}
@@ -0,0 +1,148 @@
+package apifaker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/inflection"
+)
+
+// ChildrenGenerator configures how many children are generated for every item of a parent resource,
+// the count is chosen uniformly in [Min, Max] by the random source of ApiFaker
+type ChildrenGenerator struct {
+	// Min the min count of children of every parent
+	Min int `json:"min"`
+
+	// Max the max count of children of every parent, it defaults to Min
+	Max int `json:"max,omitempty"`
+}
+
+// count returns the count of children of a parent drawn by intn
+func (generator ChildrenGenerator) count(intn func(int) int) int {
+	if generator.Max <= generator.Min {
+		return generator.Min
+	}
+	return generator.Min + intn(generator.Max-generator.Min+1)
+}
+
+// CheckGenerateChildrenMeta checks if every ChildrenGenerator has non-negative Min and Max not less than Min
+func (model *Model) CheckGenerateChildrenMeta() error {
+	for resName, generator := range model.GenerateChildren {
+		if generator.Min < 0 || (generator.Max != 0 && generator.Max < generator.Min) {
+			return JsonFileErrorf("generate_children of %s has wrong min %d or max %d in model[name=\"%s\"]", resName, generator.Min, generator.Max, model.Name)
+		}
+	}
+	return nil
+}
+
+// GenerateChildren adds the children declared by Model.GenerateChildren of every model,
+// e.g. {"comments": {"min": 1, "max": 5}} of posts adds 1 to 5 comments linked by "post_id" to every post,
+// the foreign key is set to the parent id, other columns get their defaults, examples or placeholders by type,
+// it returns an error if a child resource is unknown, has no foreign key or a generated item is invalid,
+// the children are runtime data like the created ones, call SetSeed first for reproducible children
+func (af *ApiFaker) GenerateChildren() error {
+	names := []string{}
+	for name := range af.Routers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		parent := af.Routers[name].Model
+		resNames := []string{}
+		for resName := range parent.GenerateChildren {
+			resNames = append(resNames, resName)
+		}
+		sort.Strings(resNames)
+
+		foreignKey := fmt.Sprintf("%s_id", inflection.Singular(parent.Name))
+		for _, resName := range resNames {
+			resRouter, ok := af.Routers[resName]
+			if !ok {
+				return JsonFileErrorf("generate_children has unknown resource %s in model[name=\"%s\"]", resName, parent.Name)
+			}
+			child := resRouter.Model
+			if _, ok := child.Column(foreignKey); !ok {
+				return JsonFileErrorf("generate_children resource[name=\"%s\"] has no column %s", resName, foreignKey)
+			}
+
+			for _, parentLi := range parent.lineItems() {
+				af.Lock()
+				count := parent.GenerateChildren[resName].count(af.randomSource().Intn)
+				af.Unlock()
+
+				for i := 0; i < count; i++ {
+					li, err := child.generateLineItem(map[string]interface{}{foreignKey: parentLi.Id()})
+					if err == nil {
+						err = child.Add(li)
+					}
+					if err != nil {
+						return SeedsErrorf("can not generate %s of %s[id=%v]: %v", resName, parent.Name, parentLi.Id(), err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// generateLineItem returns a new LineItem with the given values,
+// other columns except id and server managed ones get the value of Defaults, the example, or a placeholder by type
+func (model *Model) generateLineItem(values map[string]interface{}) (LineItem, error) {
+	li := NewLineItemWithMap(map[string]interface{}{})
+	sequence := model.Len() + 1
+	for _, column := range model.Columns {
+		if column.Name == "id" || (model.isServerManaged(column) && column.FromHeader == "") {
+			continue
+		}
+
+		value, ok := values[column.Name]
+		if !ok {
+			value, ok = model.Defaults[column.Name]
+		}
+		if !ok && column.Example != nil && !column.IsUnique() {
+			value, ok = column.Example, true
+		}
+		if !ok {
+			value = column.placeholder(sequence)
+		}
+
+		value, err := column.Normalize(value, model)
+		if err != nil {
+			return li, err
+		}
+		li.Set(column.Name, value)
+	}
+	return li, nil
+}
+
+// placeholder returns a value of the column type for the generated item with the given sequence,
+// strings and numbers contain the sequence to keep unique columns unique
+func (column *Column) placeholder(sequence int) interface{} {
+	switch JsonType(column.Type) {
+	case boolean:
+		return false
+	case number:
+		return float64(sequence)
+	case decimal:
+		return fmt.Sprint(sequence)
+	case blob:
+		return ""
+	case email:
+		return fmt.Sprintf("%s%d@example.com", column.Name, sequence)
+	case urlType:
+		return fmt.Sprintf("https://example.com/%s/%d", column.Name, sequence)
+	case uuid:
+		return fmt.Sprintf("00000000-0000-4000-8000-%012d", sequence)
+	case array:
+		return []interface{}{}
+	case object:
+		return map[string]interface{}{}
+	case date, datetime:
+		return time.Now().UTC().Format(column.TimeLayout())
+	case rawJSON:
+		return nil
+	}
+	return fmt.Sprintf("%s %d", column.Name, sequence)
+}
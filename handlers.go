@@ -0,0 +1,288 @@
+package apifaker
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// index handles GET /collection with the Query built from the query params without QueryFilters and QueryInclude, see Model.List,
+// responds Model.EmptyResponse if it is set and no item is left after filtering,
+// or newline-delimited json for Accept: application/x-ndjson, so Accept is added to the Vary header
+func (af *ApiFaker) index(ctx *gin.Context, model *Model) {
+	addVary(ctx, "Accept")
+	query, err := model.NewQuery(ctx.Request.URL.Query())
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	page, err := model.List(query)
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+
+	if page.Total == 0 && model.EmptyResponse != nil {
+		status := model.EmptyResponse.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		af.respond(ctx, status, model.EmptyResponse.Body)
+		return
+	}
+
+	if page.NextCursor != "" {
+		ctx.Header("X-Next-Cursor", page.NextCursor)
+	}
+	if page.Truncated {
+		ctx.Header("X-Truncated", "true")
+		ctx.Header("X-Total-Count", strconv.Itoa(page.Total))
+	}
+	if page.Clamped {
+		ctx.Header("X-Limit-Clamped", strconv.Itoa(page.Limit))
+	}
+	exposed := []string{}
+	if af.ContentRange && page.IsPartial() {
+		ctx.Header("Content-Range", page.ContentRange(model.RouteName()))
+		exposed = append(exposed, "Content-Range")
+	}
+	if links := page.Links(ctx.Request.URL); links != "" {
+		ctx.Header("Link", links)
+		exposed = append(exposed, "Link")
+	}
+	if len(exposed) > 0 {
+		ctx.Header("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	}
+	if acceptsNDJSON(ctx) {
+		af.respondNDJSON(ctx, http.StatusOK, model, model.RenderSlice(page.LineItems))
+		return
+	}
+	af.respondAction(ctx, model, IndexAction, http.StatusOK, model.RenderSlice(page.LineItems))
+}
+
+// randomIndex handles GET /collection/random,
+// responds random items chosen from the items filtered by columns and date ranges
+func (af *ApiFaker) randomIndex(ctx *gin.Context, model *Model) {
+	query := ctx.Request.URL.Query()
+	lis, err := model.filterByDateRange(model.filterByColumns(model.visibleLineItems(), model.columnFilters(query)), query)
+	if err == nil {
+		sort.Sort(lis)
+		lis, err = af.randomSample(model, lis, query)
+	}
+
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	af.respond(ctx, http.StatusOK, model.orderedJSON(model.RenderSlice(lis)))
+}
+
+// aggregate handles GET /collection/<name> of the aggregate with the given name,
+// the items are filtered by columns and date ranges
+func (af *ApiFaker) aggregate(ctx *gin.Context, model *Model, name string) {
+	query := ctx.Request.URL.Query()
+	lis, err := model.filterByDateRange(model.filterByColumns(model.visibleLineItems(), model.columnFilters(query)), query)
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	af.respond(ctx, http.StatusOK, model.Aggregates[name].compute(lis))
+}
+
+// show handles GET /collection/:id,
+// responds 304 if the item has an "updated_at" not after If-Modified-Since,
+// related collections are embedded with query param "include", columns are chosen by query param "view",
+// the status code is the value of Model.StatusColumn if it is set
+func (af *ApiFaker) show(ctx *gin.Context, model *Model) {
+	id, _ := ctx.Get("idFloat64")
+	li, _ := model.Get(id.(float64))
+	li, ok := model.visible(li)
+	if !ok {
+		af.respondError(ctx, http.StatusNotFound, nil)
+		return
+	}
+
+	if status, ok := model.SimulatedStatus(li); ok && status >= http.StatusBadRequest {
+		af.respondError(ctx, status, fmt.Errorf("simulated status %d", status))
+		return
+	}
+
+	if lastModified, ok := model.LastModified(li); ok {
+		lastModified = lastModified.UTC().Truncate(time.Second)
+		ctx.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+		since, err := http.ParseTime(ctx.Request.Header.Get("If-Modified-Since"))
+		if err == nil && !lastModified.After(since) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	include := includeNames(ctx.Request.URL.Query())
+	newLi, err := model.includeRelated(li.InsertRelatedData(model), include)
+	if err == nil {
+		var viewed LineItems
+		if viewed, err = model.selectView(LineItems{newLi}, ctx.Query("view"), include); err == nil {
+			newLi = viewed[0]
+		}
+	}
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	status, ok := model.SimulatedStatus(li)
+	if !ok {
+		status = http.StatusOK
+	}
+	af.respondAction(ctx, model, ShowAction, status, model.Render(newLi))
+}
+
+// create handles POST /collection,
+// the same Idempotency-Key header gets the LineItem created before instead of a new one,
+// a json array of items is created by bulkCreate
+func (af *ApiFaker) create(ctx *gin.Context, model *Model) {
+	if !af.checkContentType(ctx, model) {
+		return
+	}
+
+	if items, ok, err := jsonArrayBody(ctx); err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	} else if ok {
+		af.bulkCreate(ctx, model, items)
+		return
+	}
+
+	idempotencyKey := ctx.Request.Header.Get("Idempotency-Key")
+	if idempotencyKey != "" {
+		if li, ok := model.ReserveIdempotencyKey(idempotencyKey); ok {
+			af.respondAction(ctx, model, CreateAction, http.StatusOK, model.Render(li))
+			return
+		}
+	}
+
+	li, err := NewLineItemWithGinContext(ctx, model)
+	if err == nil && model.Async {
+		err = model.AddAsync(li)
+	} else if err == nil {
+		err = model.Add(li)
+	}
+
+	if err != nil {
+		if idempotencyKey != "" {
+			model.ReleaseIdempotencyKey(idempotencyKey)
+		}
+		af.respondError(ctx, ErrorStatus(err), err)
+	} else {
+		if idempotencyKey != "" {
+			model.SetIdempotencyKey(idempotencyKey, li.ID())
+		}
+		model.setPending(li.ID(), nil)
+		if model.Async {
+			ctx.Header("Location", fmt.Sprintf("%s/%s/%v", af.Prefix, model.RouteName(), model.FormatId(li.ID())))
+			af.respondAction(ctx, model, CreateAction, http.StatusAccepted, model.Render(li))
+			return
+		}
+		af.respondAction(ctx, model, CreateAction, http.StatusOK, model.Render(li))
+	}
+}
+
+// update handles PUT /collection/:id,
+// responds 201 if the item is created by Model.Upsert
+func (af *ApiFaker) update(ctx *gin.Context, model *Model) {
+	if !af.checkContentType(ctx, model) {
+		return
+	}
+
+	// allocate a new item
+	newLi, err := newLineItemWithGinContext(ctx, model, UpdateAction)
+
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+
+	// upsert
+	id, _ := ctx.Get("idFloat64")
+	if !model.Has(id.(float64)) {
+		newLi.Set("id", id)
+		if err := model.Add(newLi); err != nil {
+			af.respondError(ctx, ErrorStatus(err), err)
+		} else {
+			model.setPending(newLi.ID(), nil)
+			af.respondAction(ctx, model, UpdateAction, http.StatusCreated, model.Render(newLi))
+		}
+		return
+	}
+
+	// update
+	oldLi := model.snapshot(id.(float64))
+	if err := model.Update(id.(float64), &newLi); err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+	} else {
+		model.setPending(newLi.ID(), &oldLi)
+		af.respondAction(ctx, model, UpdateAction, http.StatusOK, updatedMap(ctx, model, oldLi, newLi))
+	}
+}
+
+// patch handles PATCH /collection/:id,
+// the body of application/merge-patch+json is applied with JSON Merge Patch semantics
+func (af *ApiFaker) patch(ctx *gin.Context, model *Model) {
+	isMergePatch := mediaType(ctx) == mergePatchMediaType
+	if !isMergePatch && !af.checkContentType(ctx, model) {
+		return
+	}
+
+	// update with attrs, got error if attrs is not complete
+	id, _ := ctx.Get("idFloat64")
+	oldLi := model.snapshot(id.(float64))
+	update := model.UpdateWithAttrs
+	if isMergePatch {
+		update = model.UpdateWithMergePatch
+	}
+	if li, err := update(id.(float64), ctx); err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+	} else {
+		model.setPending(li.ID(), &oldLi)
+		af.respondAction(ctx, model, UpdateAction, http.StatusOK, updatedMap(ctx, model, oldLi, li))
+	}
+}
+
+// notAllowed handles the routes of actions not in Model.Actions
+func (af *ApiFaker) notAllowed(ctx *gin.Context, model *Model) {
+	err := fmt.Errorf("%s %s is not allowed", ctx.Request.Method, ctx.Request.URL.Path)
+	af.respondError(ctx, http.StatusMethodNotAllowed, err)
+}
+
+// checkContentType responds 415 and returns false if model does not accept the Content-Type of request
+func (af *ApiFaker) checkContentType(ctx *gin.Context, model *Model) bool {
+	if mediaType := mediaType(ctx); !model.AcceptsContentType(mediaType) {
+		err := MediaTypeErrorf("unsupported Content-Type: %q", mediaType)
+		af.respondError(ctx, ErrorStatus(err), err)
+		return false
+	}
+	return true
+}
+
+// updatedMap returns the map of the updated LineItem,
+// only the changed fields and id if query param "only_changed" is true
+func updatedMap(ctx *gin.Context, model *Model, oldLi, newLi LineItem) map[string]interface{} {
+	if ctx.Query("only_changed") == "true" {
+		return model.Render(newLi.Diff(oldLi))
+	}
+	return model.Render(newLi)
+}
+
+// destroy handles DELETE /collection/:id, responds 204 with no body on success
+func (af *ApiFaker) destroy(ctx *gin.Context, model *Model) {
+	id, _ := ctx.Get("idFloat64")
+	if err := model.Delete(id.(float64)); err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
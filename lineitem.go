@@ -1,10 +1,12 @@
 package apifaker
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 
 	"github.com/jinzhu/inflection"
+	"reflect"
 	"sort"
 	"strconv"
 )
@@ -20,20 +22,66 @@ func NewLineItemWithMap(dataMap map[string]interface{}) LineItem {
 }
 
 // NewLineItemWithGinContext allocates and returns a new LineItem,
-// its keys are from Model.Cloumns, values are from gin.Contex.PostForm(),
-// error will be not nil if gin.Contex.PostForm() has no value for any key
+// its keys are from Model.Cloumns, values are from the json or form request body,
+// error will be not nil if the body has no value for any key required on create
 func NewLineItemWithGinContext(ctx *gin.Context, model *Model) (LineItem, error) {
+	return newLineItemWithGinContext(ctx, model, CreateAction)
+}
+
+// newLineItemWithGinContext is NewLineItemWithGinContext for the given action of create or update,
+// the columns not required on the action could be absent, Column.FromHeader is read on create
+func newLineItemWithGinContext(ctx *gin.Context, model *Model, action string) (LineItem, error) {
 	li := LineItem{make(map[string]interface{})}
 	for _, column := range model.Columns {
-		// skip id column
+		// the value of a column from a header is set on create only
+		if column.FromHeader != "" {
+			if header := ctx.Request.Header.Get(column.FromHeader); header != "" && action == CreateAction {
+				value, err := formatPostValue(column, header, model)
+				if err != nil {
+					return li, err
+				}
+				li.Set(column.Name, value)
+			}
+			continue
+		}
+
+		// the id given on create is kept, Model.Add responds a conflict if it exists
 		if column.Name == "id" {
+			if action != CreateAction {
+				continue
+			}
+			value, ok, err := postValue(ctx, column, model)
+			if err != nil {
+				return li, err
+			}
+			if ok {
+				if id, isNumber := value.(float64); !isNumber || id <= 0 || id != float64(int64(id)) {
+					return li, ParamsErrorf("invalid id: %v", value)
+				}
+				li.Set(column.Name, value)
+			}
 			continue
 		}
-		if value := ctx.PostForm(column.Name); value != "" {
-			li.SetStringValue(column.Name, value, column.Type)
-		} else {
-			return li, fmt.Errorf("doesn't has column: %s", column.Name)
+
+		// skip server managed columns
+		if model.isServerManaged(column) {
+			continue
+		}
+
+		value, ok, err := postValue(ctx, column, model)
+		if err != nil {
+			return li, err
+		}
+		if !ok && model.isAsyncStatus(column) {
+			continue
 		}
+		if !ok {
+			if !column.IsRequiredOn(action) {
+				continue
+			}
+			return li, withField(column.Name, fmt.Errorf("doesn't has column: %s", column.Name))
+		}
+		li.Set(column.Name, value)
 	}
 
 	return li, nil
@@ -86,6 +134,18 @@ func (li *LineItem) SetStringValue(key, value, valueType string) error {
 	return nil
 }
 
+// Diff allocates and returns a new LineItem only with the values of li which differ from the given old LineItem,
+// "id" is always kept
+func (li LineItem) Diff(old LineItem) LineItem {
+	diff := NewLineItemWithMap(map[string]interface{}{"id": li.Id()})
+	for key, value := range li.dataMap {
+		if oldValue, ok := old.Get(key); !ok || !reflect.DeepEqual(oldValue, value) {
+			diff.Set(key, value)
+		}
+	}
+	return diff
+}
+
 // InsertRelatedData allocates and returns a new LineItem,
 // it will has all data of the caller LineItem,
 // it will insert all related data if the given Model's has any Column named xxx_id
@@ -96,7 +156,7 @@ func (li LineItem) InsertRelatedData(model *Model) LineItem {
 	// HasOne
 	for _, resName := range model.HasOne {
 		resStruct := map[string]interface{}{}
-		if resRouter, ok := model.router.apiFaker.Routers[inflection.Plural(resName)]; ok {
+		if resRouter, ok := model.relatedRouters()[inflection.Plural(resName)]; ok {
 			resLis := resRouter.Model.ToLineItems()
 			sort.Sort(resLis)
 			for _, resLi := range resLis {
@@ -115,7 +175,7 @@ func (li LineItem) InsertRelatedData(model *Model) LineItem {
 	// HasMany
 	for _, resName := range model.HasMany {
 		resSlice := []interface{}{}
-		if resRouter, ok := model.router.apiFaker.Routers[resName]; ok {
+		if resRouter, ok := model.relatedRouters()[resName]; ok {
 			resLis := resRouter.Model.ToLineItems()
 			sort.Sort(resLis)
 			for _, resLi := range resLis {
@@ -140,7 +200,7 @@ func (li LineItem) DeleteRelatedLis(id float64, model *Model) {
 		return
 	}
 
-	for _, rotuer := range model.router.apiFaker.Routers {
+	for _, rotuer := range model.relatedRouters() {
 		var isRelatedRouter bool
 		var foreign_key = fmt.Sprintf("%s_id", inflection.Singular(model.Name))
 		for _, column := range rotuer.Model.Columns {
@@ -177,11 +237,32 @@ func FormatValue(valueType, value string) (interface{}, error) {
 		} else {
 			return booleanVal, nil
 		}
+	case rawJSON.Name():
+		var jsonVal interface{}
+		if err := json.Unmarshal([]byte(value), &jsonVal); err != nil {
+			return nilValue, err
+		} else {
+			return jsonVal, nil
+		}
 	default:
 		return value, nil
 	}
 }
 
+// toFloat64 converts the value in any go numeric type to float64, other values are returned as they are
+func toFloat64(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return value
+}
+
 // ToMap allocates and returns a new map[string]interface{} filled with LineItem's dataMap
 func (li LineItem) ToMap() map[string]interface{} {
 	newMap := map[string]interface{}{}
@@ -210,6 +291,18 @@ func (lis LineItems) Swap(i, j int) {
 	lis[j] = tmpItem
 }
 
+// Filter allocates and returns a new LineItems with the elements for which predicate returns true,
+// the order is kept
+func (lis LineItems) Filter(predicate func(LineItem) bool) LineItems {
+	filtered := LineItems{}
+	for _, li := range lis {
+		if predicate(li) {
+			filtered = append(filtered, li)
+		}
+	}
+	return filtered
+}
+
 // ToSlice return a []map[string]interface{} filled with LineItems' elements
 func (lis LineItems) ToSlice() []map[string]interface{} {
 	slice := []map[string]interface{}{}
@@ -0,0 +1,248 @@
+package apifaker
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// absentLimit the Limit of the Query without query param "limit"
+const absentLimit = -1
+
+// QueryFeature is a list processing of Query parsed by Model.NewQuery only if it is given,
+// paging, sorting, the view and fields are always parsed
+type QueryFeature int
+
+const (
+	// QueryFilters parses Query.Filters from the params named by columns
+	QueryFilters QueryFeature = 1 << iota
+
+	// QueryInclude parses Query.Include from "include"
+	QueryInclude
+)
+
+// Query is the list processing of GET /collection built once from the query params by Model.NewQuery
+// and applied by Model.List: filtering, sorting, paging, embedding related collections and choosing columns
+type Query struct {
+	// Params the query params, the date ranges are read from "<column>_after" and "<column>_before"
+	Params url.Values
+
+	// Filters the values the columns must have in their string forms, from the params named by columns, e.g. "status=paid",
+	// only with QueryFilters
+	Filters map[string]string
+
+	// Sort the columns to sort by from "sort" separated by commas, a "-" prefix means descending, e.g. "-age,name",
+	// the items are sorted by id at last
+	Sort []string
+
+	// Limit the max count of items from "limit", 0 means no limit, absentLimit means Model.DefaultLimit is used
+	Limit int
+
+	// All ignores Model.DefaultLimit, from "all=true"
+	All bool
+
+	// Offset skips the first offset items, from "offset"
+	Offset int
+
+	// After the cursor from "after", the items after the one it encodes are listed, it can not be used with Offset
+	After string
+
+	// View the name of the view choosing the columns, from "view"
+	View string
+
+	// Fields the columns responded besides id, from "fields" separated by commas, they are chosen after View
+	Fields []string
+
+	// Include the resource names of the related collections to embed, from "include" separated by commas,
+	// only with QueryInclude
+	Include []string
+}
+
+// NewQuery returns the Query built from the given query params with the given features,
+// or a QueryError if any param is malformed
+func (model *Model) NewQuery(params url.Values, features ...QueryFeature) (Query, error) {
+	query := Query{
+		Params: params,
+		Sort:   splitParam(params, "sort"),
+		Limit:  absentLimit,
+		All:    params.Get("all") == "true",
+		After:  params.Get("after"),
+		View:   params.Get("view"),
+		Fields: splitParam(params, "fields"),
+	}
+	for _, feature := range features {
+		switch feature {
+		case QueryFilters:
+			query.Filters = model.columnFilters(params)
+		case QueryInclude:
+			query.Include = includeNames(params)
+		}
+	}
+
+	for _, name := range query.Sort {
+		if _, ok := model.Column(strings.TrimPrefix(name, "-")); !ok {
+			return query, QueryErrorf("sort has unknown column: %s", name)
+		}
+	}
+	for _, name := range query.Fields {
+		if _, ok := model.Column(name); !ok {
+			return query, QueryErrorf("fields has unknown column: %s", name)
+		}
+	}
+
+	var err error
+	if limitStr := params.Get("limit"); limitStr != "" {
+		if query.Limit, err = strconv.Atoi(limitStr); err != nil || query.Limit < 0 {
+			return query, QueryErrorf("limit must be a non-negative integer, value: %s", limitStr)
+		}
+	}
+	if offsetStr := params.Get("offset"); offsetStr != "" {
+		if query.Offset, err = strconv.Atoi(offsetStr); err != nil || query.Offset < 0 {
+			return query, QueryErrorf("offset must be a non-negative integer, value: %s", offsetStr)
+		}
+		if query.After != "" {
+			return query, QueryErrorf("after and offset can not be used together")
+		}
+	}
+	if query.After != "" {
+		if _, err := decodeCursor(query.After); err != nil {
+			return query, err
+		}
+		// the cursor is an id, so it only works in the order of ids
+		if len(query.Sort) > 0 {
+			return query, QueryErrorf("after and sort can not be used together")
+		}
+	}
+	return query, nil
+}
+
+// includeNames returns the resource names of query param "include" separated by commas
+func includeNames(params url.Values) []string {
+	return splitParam(params, "include")
+}
+
+// splitParam returns the trimmed values of the query param with the given name separated by commas
+func splitParam(params url.Values, name string) []string {
+	param := params.Get(name)
+	if param == "" {
+		return nil
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(param, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return values
+}
+
+// List returns the Page of the visible LineItems processed by the Query,
+// the Storage is iterated and only the matched items are kept, the related data is inserted into the items of the Page,
+// which have the included collections and the columns of the view and fields
+func (model *Model) List(query Query) (Page, error) {
+	inRange, err := model.dateRangeFilter(query.Params)
+	if err != nil {
+		return Page{}, err
+	}
+	lis := LineItems{}
+	model.eachVisible(func(li LineItem) bool {
+		if matchColumns(li, query.Filters) && inRange(li) {
+			lis = append(lis, li)
+		}
+		return true
+	})
+
+	sort.Sort(lis)
+	model.sortBy(lis, query.Sort)
+	page := query.paginate(lis, model.DefaultLimit, model.MaxLimit)
+	items := LineItems{}
+	for _, li := range page.LineItems {
+		newLi, err := model.includeRelated(li.InsertRelatedData(model), query.Include)
+		if err != nil {
+			return page, err
+		}
+		items = append(items, newLi)
+	}
+	// the view keeps the keys named by query param "include" too, like the has_many collections
+	kept := append(includeNames(query.Params), query.Include...)
+	if page.LineItems, err = model.selectView(items, query.View, kept); err != nil {
+		return page, err
+	}
+	if len(query.Fields) > 0 {
+		page.LineItems = pickKeys(page.LineItems, append(append([]string{"id"}, query.Fields...), kept...))
+	}
+	return page, nil
+}
+
+// sortBy sorts the LineItems by the given columns of Query.Sort stably
+func (model *Model) sortBy(lis LineItems, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	sort.SliceStable(lis, func(i, j int) bool {
+		for _, name := range names {
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+			column, _ := model.Column(name)
+			a, _ := lis[i].Get(name)
+			b, _ := lis[j].Get(name)
+			if result := compareValues(column, a, b); result != 0 {
+				return (result < 0) != desc
+			}
+		}
+		return false
+	})
+}
+
+// compareValues returns -1, 0 or 1 by comparing the values of the column, a missing value is the smallest,
+// dates and datetimes are compared by their times in the format of the column,
+// numbers and booleans by their values and others in their string forms
+func compareValues(column *Column, a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if column != nil && column.IsTime() {
+		if x, ok := column.ParseTime(a); ok {
+			if y, ok := column.ParseTime(b); ok {
+				switch {
+				case x.Before(y):
+					return -1
+				case x.After(y):
+					return 1
+				}
+				return 0
+			}
+		}
+	}
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
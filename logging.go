@@ -0,0 +1,137 @@
+package apifaker
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetValidationLogger sets the logger of validation failures, nil stops logging, it is nil by default,
+// every POST, PUT or PATCH of a resource getting a 400, 409, 415 or 422 is logged at warn level
+// with the resource, the offending field if it is known and the reason
+func (af *ApiFaker) SetValidationLogger(logger *slog.Logger) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.validationLogger = logger
+}
+
+// logValidationFailure logs the error of the request responded with the given code if it is a validation failure
+func (af *ApiFaker) logValidationFailure(ctx *gin.Context, code int, err error) {
+	af.RLock()
+	logger := af.validationLogger
+	af.RUnlock()
+
+	if logger == nil || err == nil {
+		return
+	}
+	switch ctx.Request.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+	switch code {
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+	default:
+		return
+	}
+
+	resource, _ := ctx.Get("resource")
+	attrs := []interface{}{
+		slog.String("method", ctx.Request.Method),
+		slog.String("path", ctx.Request.URL.Path),
+		slog.String("request_id", ctx.GetString("requestID")),
+		slog.Int("status", code),
+		slog.Any("resource", resource),
+	}
+	if field := fieldOf(err); field != "" {
+		attrs = append(attrs, slog.String("field", field))
+	}
+	attrs = append(attrs, slog.String("reason", err.Error()))
+	logger.Warn("validation failed", attrs...)
+}
+
+// fieldOf returns the Field of the FieldError in the chain of the validation error, or "" if it is unknown
+func fieldOf(err error) string {
+	var fieldErr FieldError
+	if errors.As(err, &fieldErr) {
+		return fieldErr.Field
+	}
+	return ""
+}
+
+// SetBodyLogging turns on or turns off logging the bodies of requests and responses of the Model at runtime
+func (model *Model) SetBodyLogging(on bool) {
+	var value int32
+	if on {
+		value = 1
+	}
+	atomic.StoreInt32(&model.bodyLogging, value)
+}
+
+// BodyLogging returns if the bodies of requests and responses of the Model are logged
+func (model *Model) BodyLogging() bool {
+	return atomic.LoadInt32(&model.bodyLogging) == 1
+}
+
+// SetBodyLogger sets the logger of the bodies of the models with body logging on, nil means slog.Default()
+func (af *ApiFaker) SetBodyLogger(logger *slog.Logger) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.bodyLogger = logger
+}
+
+// bodyLogWriter keeps a copy of the response body
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w bodyLogWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter
+func (w bodyLogWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// logBodies reads the request body and keeps a copy of the response body of the resource,
+// the returned func logs them at info level after the handler
+func (af *ApiFaker) logBodies(ctx *gin.Context, resource string) func() {
+	af.RLock()
+	logger := af.bodyLogger
+	af.RUnlock()
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	requestBody := []byte{}
+	if ctx.Request.Body != nil {
+		requestBody, _ = ioutil.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+	writer := bodyLogWriter{ResponseWriter: ctx.Writer, body: &bytes.Buffer{}}
+	ctx.Writer = writer
+
+	return func() {
+		logger.Info("bodies",
+			slog.String("method", ctx.Request.Method),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.String("request_id", ctx.GetString("requestID")),
+			slog.String("resource", resource),
+			slog.Int("status", writer.Status()),
+			slog.String("request_body", string(requestBody)),
+			slog.String("response_body", writer.body.String()),
+		)
+	}
+}
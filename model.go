@@ -1,36 +1,196 @@
 package apifaker
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
 	"github.com/Focinfi/gset"
 	"github.com/Focinfi/gtester"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/inflection"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// values of Model.OnDelete
+const (
+	CascadeOnDelete  = "cascade"
+	RestrictOnDelete = "restrict"
+	OrphanOnDelete   = "orphan"
+)
+
+// defaultHotItems the max number of items of Model.SeedsFile kept in memory if Model.HotItems is 0
+const defaultHotItems = 1000
+
 type Model struct {
 	Name string `json:"resource_name"`
 
+	// Route the path segment of routes, e.g. "people", it overrides Pluralize
+	Route string `json:"route,omitempty"`
+
+	// Pluralize makes the path segment of routes the plural of Name, e.g. "person" to "people"
+	Pluralize bool `json:"pluralize,omitempty"`
+
+	// IdFormat the format of ids in routes and responses, e.g. "USR-%05d" makes the id 42 "USR-00042",
+	// the numeric part is stored for ordering and relationships, seeds could use both forms
+	IdFormat string `json:"id_format,omitempty"`
+
+	// Singleton makes the model a single item without collection or id, e.g. /settings,
+	// only GET and PUT are routed, seeds must have exactly one item
+	Singleton bool `json:"singleton,omitempty"`
+
 	// Seeds acts as a snapshot of the whole database
 	Seeds   []map[string]interface{} `json:"seeds"`
 	Columns []*Column                `json:"columns"`
 
+	// SeedProfiles the named seed sets, a request with X-Seed-Profile header sees the data initialized from them
+	SeedProfiles map[string][]map[string]interface{} `json:"seed_profiles,omitempty"`
+
+	// SeedsFile the JSON Lines file of a very large dataset, relative to the json file of the Model,
+	// its items are read lazily by a file-backed Storage instead of being loaded into memory like Seeds
+	SeedsFile string `json:"seeds_file,omitempty"`
+
+	// HotItems the max number of items of SeedsFile kept in memory, 0 means defaultHotItems
+	HotItems int `json:"hot_items,omitempty"`
+
+	// Defaults fills the omitted columns of every seed when loading, explicit seed values win
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+
 	// relationships
 	HasMany []string `json:"has_many"`
 	HasOne  []string `json:"has_one"`
 
-	// Set contains runtime data
-	Set *gset.SetThreadSafe `json:"-"`
+	// OnDelete how to handle the items referencing a deleted item by a foreign key like "user_id":
+	// "cascade"(default) deletes them, "restrict" refuses to delete with a ConflictError, "orphan" keeps them
+	OnDelete string `json:"on_delete,omitempty"`
+
+	// Actions the whitelist of index, show, create, update and delete,
+	// the routes of other actions respond 405, empty means all actions
+	Actions []string `json:"actions,omitempty"`
+
+	// Aggregates the computed endpoints like GET /collection/stats using the path segment as the key,
+	// e.g. {"stats": {"column": "amount", "group_by": "status"}}
+	Aggregates map[string]*Aggregate `json:"aggregates,omitempty"`
+
+	// Views the named column subsets of GET responses chosen by query param "view",
+	// e.g. {"summary": ["id", "name"]}, id is always responded
+	Views map[string][]string `json:"views,omitempty"`
+
+	// Templates the text/template of responses for index, show, create and update,
+	// using action as the key, see templateData for the data
+	Templates map[string]string `json:"templates,omitempty"`
+
+	// Headers the static headers of every response of this model, e.g. {"Cache-Control": "no-store"}
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// ContentTypes the accepted media types of request body for create and update,
+	// defaults are application/json, application/x-www-form-urlencoded and multipart/form-data
+	ContentTypes []string `json:"content_types,omitempty"`
+
+	// GenerateChildren the children generated by ApiFaker.GenerateChildren for every item using the child resource name as the key,
+	// e.g. {"comments": {"min": 3}} of posts generates 3 comments linked by "post_id" to every post
+	GenerateChildren map[string]ChildrenGenerator `json:"generate_children,omitempty"`
+
+	// UniqueTogether the groups of columns whose values must be unique together, e.g. [["first_name", "last_name"]],
+	// an item duplicating the values of a group gets a 409, a group is skipped for an item without any of its columns
+	UniqueTogether [][]string `json:"unique_together,omitempty"`
+
+	// RequiredParams the query params every request of this resource must have, e.g. ["api_version"],
+	// a request without any of them gets a 400
+	RequiredParams []string `json:"required_params,omitempty"`
+
+	// MaxRecords the max number of items, adding more gets an InsufficientStorageError, 0 means no limit
+	MaxRecords int `json:"max_records,omitempty"`
+
+	// DefaultLimit the page size of GET /collection without limit param, 0 means no limit
+	DefaultLimit int `json:"default_limit,omitempty"`
+
+	// MaxLimit the max page size of GET /collection, a bigger limit or no limit is clamped down to it, 0 means no limit
+	MaxLimit int `json:"max_limit,omitempty"`
+
+	// SoftDelete the name of a boolean column, DELETE /collection/:id sets it true instead of removing the item,
+	// soft deleted items are excluded from GET /collection and get 404 from other routes
+	SoftDelete string `json:"soft_delete,omitempty"`
+
+	// ShowDeleted makes GET /collection/:id respond the soft deleted item instead of 404
+	ShowDeleted bool `json:"show_deleted,omitempty"`
+
+	// GoneOnDelete remembers the ids of deleted items, the routes of them get 410 instead of 404
+	GoneOnDelete bool `json:"gone_on_delete,omitempty"`
+
+	// StatusColumn the name of a number column, GET /collection/:id responds its value as the status code,
+	// e.g. an item with 500 gets a 500, 0 means the normal response
+	StatusColumn string `json:"status_column,omitempty"`
+
+	// Upsert makes PUT /collection/:id create the item with the id if it does not exist
+	Upsert bool `json:"upsert,omitempty"`
+
+	// Async makes POST /collection respond 202 with a Location of the created item,
+	// whose status is "pending" until it turns "completed" after AsyncDelay milliseconds
+	Async bool `json:"async,omitempty"`
+
+	// AsyncDelay the milliseconds before an async item is completed
+	AsyncDelay int `json:"async_delay_ms,omitempty"`
+
+	// EmptyResponse the response of GET /collection when no item is left after filtering,
+	// e.g. {"status": 404} or {"status": 200, "body": {"data": []}}, nil means an empty array
+	EmptyResponse *Response `json:"empty_response,omitempty"`
+
+	// IncludeLimit the max number of items of every collection included by GET /collection/:id?include=,
+	// 0 means defaultIncludeLimit
+	IncludeLimit int `json:"include_limit,omitempty"`
+
+	// ConsistencyDelay the milliseconds a created or updated item is invisible to GET after the write,
+	// the previous version of an updated item is responded in the delay, 0 means no delay
+	ConsistencyDelay int `json:"consistency_delay_ms,omitempty"`
+
+	// Delay the milliseconds to wait before responding using the request method as the key,
+	// e.g. {"POST": 800, "*": 50} slows down writes more than others, "*" is for the methods not in it
+	Delay map[string]int `json:"delay,omitempty"`
+
+	// IdempotencyTTL the milliseconds an Idempotency-Key is remembered, 0 means forever
+	IdempotencyTTL int `json:"idempotency_ttl_ms,omitempty"`
+
+	// ReassignMergedIds makes MergeSeeds give new ids to the seeds whose ids have been used instead of an error
+	ReassignMergedIds bool `json:"-"`
+
+	// Set contains runtime data, it is in memory by default, see SetStorage
+	Set Storage `json:"-"`
 
 	// currentId records the max of id
 	currentId float64
 
 	// dataChanged signs if differs between Set and Seeds
 	dataChanged bool
+
+	// idempotencyKeys records the created id for every Idempotency-Key
+	idempotencyKeys map[string]idempotencyRecord
+
+	// reservedKeys the Idempotency-Keys whose creates are running, the channel is closed when it finishes
+	reservedKeys map[string]chan struct{}
+
+	// pendings records the writes invisible in ConsistencyDelay
+	pendings map[float64]pendingRecord
+
+	// tombstones records the ids of the items deleted with GoneOnDelete
+	tombstones map[float64]bool
+
+	// fsys the read-only file system the Model is loaded from by NewModelWithFS
+	fsys fs.FS
+
+	// bodyLogging signs if the bodies of requests and responses are logged, 1 for on, it is accessed atomically
+	bodyLogging int32
+
 	sync.RWMutex
 	router *Router
 }
@@ -41,13 +201,13 @@ func NewModel(router *Router) *Model {
 	return &Model{
 		Seeds:   []map[string]interface{}{},
 		Columns: []*Column{},
-		Set:     gset.NewSetThreadSafe(),
+		Set:     NewMemoryStorage(),
 		router:  router,
 	}
 }
 
 // NewModelWithPath allocates and returns a new Model,
-// using the given path as it's json file path
+// using the given path as it's json file path, a file ending with ".gz" is decompressed by gzip
 func NewModelWithPath(path string, router *Router) (*Model, error) {
 	// open file
 	file, err := os.Open(path)
@@ -56,22 +216,218 @@ func NewModelWithPath(path string, router *Router) (*Model, error) {
 	}
 	defer file.Close()
 
+	return newModelWithReader(file, path, router)
+}
+
+// NewModelWithFS allocates and returns a new Model like NewModelWithPath,
+// but reads the json file with the given path from fsys, e.g. an embed.FS of fixtures,
+// SaveToFile of the Model always returns an error for fsys is read-only
+func NewModelWithFS(fsys fs.FS, path string, router *Router) (*Model, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	model, err := newModelWithReader(file, path, router)
+	if err != nil {
+		return nil, err
+	}
+	model.fsys = fsys
+	return model, nil
+}
+
+// NewModelsWithPath allocates and returns the Models in the json file with the given path,
+// the file could be a combined one of an array of models, or an object using resource names as keys,
+// e.g. {"users": {"columns": [...]}, "books": {...}}, or a single model like NewModelWithPath,
+// every Model gets its own Router of the given ApiFaker and is checked like the one in a single file,
+// a combined file can not be saved, so SaveToFile of its Models returns an error
+func NewModelsWithPath(path string, apiFaker *ApiFaker) ([]*Model, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raws := []json.RawMessage{}
+	if trimmed := strings.TrimSpace(string(bytes)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(bytes, &raws); err != nil {
+			return nil, JsonFileErrorf("%s has wrong models: %v", path, err)
+		}
+	} else {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(bytes, &object); err != nil {
+			return nil, JsonFileErrorf("%s has wrong models: %v", path, err)
+		}
+		if _, ok := object["resource_name"]; ok {
+			router, err := NewRouterWithPath(path, apiFaker)
+			if err != nil {
+				return nil, err
+			}
+			return []*Model{router.Model}, nil
+		}
+
+		names := []string{}
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			definition := map[string]interface{}{}
+			if err := json.Unmarshal(object[name], &definition); err != nil {
+				return nil, JsonFileErrorf("%s has wrong model %s: %v", path, name, err)
+			}
+			// the key is the resource name
+			definition["resource_name"] = name
+			raw, _ := json.Marshal(definition)
+			raws = append(raws, raw)
+		}
+	}
+
+	models := []*Model{}
+	for i, raw := range raws {
+		router := &Router{apiFaker: apiFaker, filePath: path, combined: true}
+		model, err := newModelWithReader(strings.NewReader(string(raw)), path, router)
+		if err != nil {
+			return nil, JsonFileErrorf("%s has wrong model[%d]: %v", path, i, err)
+		}
+		router.Model = model
+		router.setRestRoutes()
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// combinedModel returns the Model with the given name in the combined file of the given path
+func combinedModel(path, name string, apiFaker *ApiFaker) (*Model, error) {
+	models, err := NewModelsWithPath(path, apiFaker)
+	if err != nil {
+		return nil, err
+	}
+	for _, model := range models {
+		if model.Name == name {
+			return model, nil
+		}
+	}
+	return nil, JsonFileErrorf("%s has no model %s", path, name)
+}
+
+// newModelWithReader allocates and returns a new Model with the json read from file,
+// the file with the given path ending with ".gz" is decompressed by gzip
+func newModelWithReader(file io.Reader, path string, router *Router) (*Model, error) {
+	var err error
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, JsonFileErrorf("%s is not a gzip file: %v", path, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
 	model := NewModel(router)
 	bytes := []byte{}
 
-	err = gtester.NewInspector().
-		Check(func() error { bytes, err = ioutil.ReadAll(file); return err }).
-		Check(func() error { return json.Unmarshal(bytes, model) }).
-		Check(model.CheckRelationshipsMeta).
-		Check(model.CheckColumnsMeta).
-		Check(model.ValidateSeedsValue).
-		Then(func() {
-			model.initSet()
-		})
+	err = gtester.NewCheckQueue().
+		Add(func() error { bytes, err = ioutil.ReadAll(reader); return err }).
+		Add(func() error { return json.Unmarshal(bytes, model) }).
+		Add(model.checkAndInit).
+		Run()
 
 	return model, err
 }
 
+// checkAndInit checks the meta and seeds of the Model, then initializes its runtime data from the seeds
+func (model *Model) checkAndInit() error {
+	return gtester.NewCheckQueue().
+		Add(model.CheckRelationshipsMeta).
+		Add(model.CheckColumnsMeta).
+		Add(model.CheckAsyncMeta).
+		Add(model.CheckActionsMeta).
+		Add(model.CheckOnDeleteMeta).
+		Add(model.CheckTemplatesMeta).
+		Add(model.CheckAggregatesMeta).
+		Add(model.CheckViewsMeta).
+		Add(model.CheckSingletonMeta).
+		Add(model.CheckDelayMeta).
+		Add(model.CheckGenerateChildrenMeta).
+		Add(model.CheckUniqueTogetherMeta).
+		Add(model.CheckSeedsFileMeta).
+		Add(model.MergeDefaults).
+		Add(model.NormalizeSeeds).
+		Add(model.ValidateSeedsValue).
+		Add(model.CheckSeedsUniqueness).
+		Add(model.initSeedsFile).
+		Add(model.initSet).
+		Run()
+}
+
+// GenerateModelFromSample allocates and returns a new Model named resourceName,
+// its Columns are inferred from the sample, which is also the first seed,
+// numbers are "number", strings "string", bools "boolean", arrays "array", objects "object" and null "json",
+// the sample values become the examples of columns except id,
+// an id of 1 is added if the sample has no id, call SaveToFile to persist it as a json file
+func GenerateModelFromSample(resourceName string, sample map[string]interface{}) (*Model, error) {
+	model := NewModel(&Router{filePath: resourceName + ".json"})
+	model.Name = resourceName
+
+	seed := map[string]interface{}{"id": float64(1)}
+	for key, value := range sample {
+		seed[key] = toFloat64(value)
+	}
+
+	names := []string{}
+	for key := range seed {
+		if key != "id" {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range append([]string{"id"}, names...) {
+		var jsonType JsonType
+		switch seed[name].(type) {
+		case float64:
+			jsonType = number
+		case string:
+			jsonType = str
+		case bool:
+			jsonType = boolean
+		case []interface{}:
+			jsonType = array
+		case map[string]interface{}:
+			jsonType = object
+		case nil:
+			jsonType = rawJSON
+		default:
+			return nil, ColumnsErrorf("column[name=\"%s\"] has unsupportted value: %v", name, seed[name])
+		}
+		column := &Column{Name: name, Type: jsonType.Name()}
+		if name != "id" {
+			column.Example = seed[name]
+		}
+		model.Columns = append(model.Columns, column)
+	}
+	model.Seeds = append(model.Seeds, seed)
+
+	err := gtester.NewCheckQueue().
+		Add(model.CheckColumnsMeta).
+		Add(model.ValidateSeedsValue).
+		Add(model.initSet).
+		Run()
+
+	return model, err
+}
+
+// relatedRouters returns the Routers of the ApiFaker which the Model belongs to,
+// it is nil if the Model is not added to an ApiFaker
+func (model *Model) relatedRouters() map[string]*Router {
+	if model.router == nil || model.router.apiFaker == nil {
+		return nil
+	}
+	return model.router.apiFaker.routers()
+}
+
 // updateId updates currentId if the given id is bigger
 func (model *Model) updateId(id float64) {
 	if id > model.currentId {
@@ -90,121 +446,801 @@ func (model *Model) Len() int {
 	return model.Set.Len()
 }
 
+// FormatId returns the id formatted by IdFormat, or the id itself without IdFormat
+func (model *Model) FormatId(id float64) interface{} {
+	if model.IdFormat == "" {
+		return id
+	}
+	return fmt.Sprintf(model.IdFormat, int64(id))
+}
+
+// ParseId returns the numeric id of the given id in routes or seeds,
+// it must be an integer or formatted by IdFormat, otherwise a params error of invalid id is returned
+func (model *Model) ParseId(idStr string) (float64, error) {
+	if model.IdFormat == "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return 0, ParamsErrorf("invalid id: %s", idStr)
+		}
+		return float64(id), nil
+	}
+
+	var id int64
+	if _, err := fmt.Sscanf(idStr, model.IdFormat, &id); err != nil || model.FormatId(float64(id)) != idStr {
+		return 0, ParamsErrorf("invalid id: %s does not match id_format %s", idStr, model.IdFormat)
+	}
+	return float64(id), nil
+}
+
+// RouteName returns the path segment of routes, it is Route, the plural of Name if Pluralize is true, or Name
+func (model *Model) RouteName() string {
+	if model.Route != "" {
+		return model.Route
+	}
+	if model.Pluralize {
+		return inflection.Plural(model.Name)
+	}
+	return model.Name
+}
+
+// Allows returns if the given action is in the Actions
+func (model *Model) Allows(action string) bool {
+	if len(model.Actions) == 0 {
+		return true
+	}
+
+	for _, allowed := range model.Actions {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsContentType returns if model accepts request body in the given media type
+func (model *Model) AcceptsContentType(mediaType string) bool {
+	contentTypes := model.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultContentTypes
+	}
+
+	for _, contentType := range contentTypes {
+		if contentType == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUniqueTogetherMeta checks if every group of UniqueTogether has at least two known columns
+func (model *Model) CheckUniqueTogetherMeta() error {
+	for _, group := range model.UniqueTogether {
+		if len(group) < 2 {
+			return ColumnsErrorf("unique_together group %v must have at least two columns in file: %s", group, model.router.filePath)
+		}
+		for _, name := range group {
+			if _, ok := model.Column(name); !ok {
+				return ColumnsErrorf("unique_together group %v has unknown column \"%s\" in file: %s", group, name, model.router.filePath)
+			}
+		}
+	}
+	return nil
+}
+
+// checkUniqueTogether returns a ConflictError if the given item of values duplicates the values of a group of UniqueTogether
+// of another item, the items with the same id are the same one
+func (model *Model) checkUniqueTogether(m map[string]interface{}) error {
+	for _, group := range model.UniqueTogether {
+		values := make([]interface{}, 0, len(group))
+		for _, name := range group {
+			if value, ok := m[name]; ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) < len(group) {
+			continue
+		}
+
+		duplicated := false
+		model.Set.Iterate(func(li LineItem) bool {
+			if reflect.DeepEqual(li.Id(), m["id"]) {
+				return true
+			}
+			duplicated = true
+			for i, name := range group {
+				value, ok := li.Get(name)
+				duplicated = duplicated && ok && reflect.DeepEqual(value, values[i])
+			}
+			return !duplicated
+		})
+		if duplicated {
+			return ConflictErrorf("columns %v in model[name=\"%s\"] values %v already exist", group, model.Name, values)
+		}
+	}
+	return nil
+}
+
+// CheckRequiredParams returns a query error if any of RequiredParams is absent in the given query
+func (model *Model) CheckRequiredParams(query url.Values) error {
+	for _, name := range model.RequiredParams {
+		if _, ok := query[name]; !ok {
+			return QueryErrorf("query param %s is required", name)
+		}
+	}
+	return nil
+}
+
+// Column returns the Column with the given name and if it exists
+func (model *Model) Column(name string) (*Column, bool) {
+	for _, column := range model.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return nil, false
+}
+
 // Has returns if Model has LineItem with the given id
 func (model *Model) Has(id float64) bool {
-	return model.Set.Has(gset.T(id))
+	return model.Set.Has(id)
 }
 
 // Get gets and returns element with id param and the existence of it
-func (model *Model) Get(id float64) (li LineItem, ok bool) {
-	var element interface{}
-	if element, ok = model.Set.Get(id); ok {
-		li, ok = element.(LineItem)
-	}
-	return
+func (model *Model) Get(id float64) (LineItem, bool) {
+	return model.Set.Get(id)
 }
 
-// Add add a LineItem to Model.Set
+// snapshot returns a copy of the LineItem with the given id,
+// it will not be changed by the following updates in place
+func (model *Model) snapshot(id float64) LineItem {
+	li, _ := model.Get(id)
+	return NewLineItemWithMap(li.ToMap())
+}
+
+// Intersect returns the LineItems of model whose ids are in the other Model, sorted by id
+func (model *Model) Intersect(other *Model) LineItems {
+	return model.lineItems().Filter(func(li LineItem) bool {
+		return other.Has(li.ID())
+	})
+}
+
+// Union returns the LineItems of model and the ones of the other Model whose ids are not in model, sorted by id
+func (model *Model) Union(other *Model) LineItems {
+	lis := append(model.lineItems(), other.Difference(model)...)
+	sort.Sort(lis)
+	return lis
+}
+
+// Difference returns the LineItems of model whose ids are not in the other Model, sorted by id
+func (model *Model) Difference(other *Model) LineItems {
+	return model.lineItems().Filter(func(li LineItem) bool {
+		return !other.Has(li.ID())
+	})
+}
+
+// FindBy returns the first LineItem sorted by id whose value of the given column equals to the given value,
+// and if it exists, numbers in any go numeric type are compared as float64
+func (model *Model) FindBy(column string, value interface{}) (LineItem, bool) {
+	value = toFloat64(value)
+	found, ok := LineItem{}, false
+	model.Set.Iterate(func(li LineItem) bool {
+		if current, has := li.Get(column); has && reflect.DeepEqual(toFloat64(current), value) && (!ok || li.ID() < found.ID()) {
+			found, ok = li, true
+		}
+		return true
+	})
+	return found, ok
+}
+
+// Add add a LineItem to Model.Set, returns an InsufficientStorageError if Model has MaxRecords items,
+// or a ConflictError if the id of the LineItem exists
 func (model *Model) Add(li LineItem) error {
 	model.Lock()
 	defer model.Unlock()
 
+	if model.MaxRecords > 0 && model.Set.Len() >= model.MaxRecords {
+		return InsufficientStorageErrorf("model[name=\"%s\"] is full of %d items", model.Name, model.MaxRecords)
+	}
+
 	// set id if the given LineItem has no id
 	if _, ok := li.Get("id"); !ok {
 		li.Set("id", model.nextId())
+	} else if model.Set.Has(li.ID()) {
+		return ConflictErrorf("model[name=\"%s\"] has the item[id=%v]", model.Name, li.Id())
+	}
+	model.setSlugs(li)
+	if _, ok := li.Get(model.SoftDelete); !ok && model.SoftDelete != "" {
+		li.Set(model.SoftDelete, false)
 	}
 
+	if err := model.checkUniqueTogether(li.ToMap()); err != nil {
+		return err
+	}
 	if err := model.Validate(li.ToMap()); err != nil {
 		return err
+	} else if err := model.Set.Add(li); err != nil {
+		return err
+	} else {
+		model.dataChanged = true
+		model.addUniqueValues(li)
+		model.updateId(li.ID())
+		delete(model.tombstones, li.ID())
+	}
+
+	return nil
+}
+
+// Update updates the LineItem with the given id by the given LineItem
+func (model *Model) Update(id float64, li *LineItem) error {
+	oldLi, ok := model.Get(id)
+	if !ok {
+		return SeedsErrorf("model %s[id:%d] does not exsit", model.Name, id)
+	}
+
+	model.Lock()
+	defer model.Unlock()
+
+	// set id if the given LineItem has no id
+	if _, ok := li.Get("id"); !ok {
+		li.Set("id", id)
+	}
+
+	// keep server managed values and the absent ones not required on update,
+	// let them pass the uniqueness checking
+	for _, column := range model.Columns {
+		if _, ok := li.Get(column.Name); !ok && (model.isServerManaged(column) || !column.IsRequiredOn(UpdateAction)) {
+			value, found := oldLi.Get(column.Name)
+			if !found {
+				continue
+			}
+			li.Set(column.Name, value)
+			column.RemoveUniquenessOf(value)
+			defer column.AddUniquenessOf(value)
+		}
+	}
+
+	if err := model.checkUniqueTogether(li.dataMap); err != nil {
+		return err
+	}
+	if err := model.Validate(li.dataMap); err != nil {
+		return err
+	} else if err := model.Set.Add(*li); err != nil {
+		return err
 	} else {
-		model.Set.Add(li)
 		model.dataChanged = true
+		model.removeUniqueValues(oldLi)
+		model.addUniqueValues(*li)
+	}
+
+	return nil
+}
+
+// Delete deletes the LineItem and handles its related data by OnDelete with the given id,
+// returns a NotFoundError if it does not exist or has been soft deleted,
+// or a ConflictError if it or the related data to cascade is referenced by a model restricted on delete,
+// the LineItem is only marked as deleted if SoftDelete is set
+func (model *Model) Delete(id float64) error {
+	if model.SoftDelete != "" {
+		model.Lock()
+		defer model.Unlock()
+
+		li, ok := model.Get(id)
+		if !ok || model.IsDeleted(li) {
+			return NotFoundErrorf("model[name=\"%s\"] has no item[id=%v]", model.Name, id)
+		}
+		li.Set(model.SoftDelete, true)
+		if err := model.Set.Add(li); err != nil {
+			return err
+		}
+		model.dataChanged = true
+		return nil
+	}
+
+	if !model.Has(id) {
+		return NotFoundErrorf("model[name=\"%s\"] has no item[id=%v]", model.Name, id)
+	}
+	if err := model.checkDeletable(id); err != nil {
+		return err
+	}
+
+	model.Lock()
+	defer model.Unlock()
+
+	li, ok := model.Get(id)
+
+	if !ok {
+		return NotFoundErrorf("model[name=\"%s\"] has no item[id=%v]", model.Name, id)
+	}
+
+	if model.OnDelete != OrphanOnDelete {
+		li.DeleteRelatedLis(id, model)
+	}
+	if err := model.Set.Remove(id); err != nil {
+		return err
+	}
+	model.dataChanged = true
+	model.removeUniqueValues(li)
+	if model.GoneOnDelete {
+		if model.tombstones == nil {
+			model.tombstones = map[float64]bool{}
+		}
+		model.tombstones[id] = true
+	}
+	return nil
+}
+
+// IsGone returns if the item with the given id has been deleted with GoneOnDelete
+func (model *Model) IsGone(id float64) bool {
+	model.RLock()
+	defer model.RUnlock()
+
+	return model.tombstones[id]
+}
+
+// checkDeletable returns a ConflictError if the LineItem with the given id is referenced and OnDelete is restrict,
+// the related data to cascade are checked recursively
+func (model *Model) checkDeletable(id float64) error {
+	if model.OnDelete == OrphanOnDelete {
+		return nil
+	}
+
+	foreignKey := fmt.Sprintf("%s_id", inflection.Singular(model.Name))
+	for _, router := range model.relatedRouters() {
+		if _, ok := router.Model.Column(foreignKey); !ok {
+			continue
+		}
+
+		for _, li := range router.Model.lineItems() {
+			if value, ok := li.Get(foreignKey); !ok || toFloat64(value) != id {
+				continue
+			}
+
+			if model.OnDelete == RestrictOnDelete {
+				return ConflictErrorf("model[name=\"%s\"] item[id=%v] is referenced by %s[id=%v]", model.Name, id, router.Model.Name, li.Id())
+			}
+			if err := router.Model.checkDeletable(li.ID()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MergeSeeds adds the seeds of the other Model into model, every seed is validated,
+// a seed whose id has been used gets a new id if ReassignMergedIds is true, otherwise an error is returned,
+// nothing is merged if any seed is wrong
+func (model *Model) MergeSeeds(other *Model) error {
+	added := []LineItem{}
+	for _, seed := range other.Seeds {
+		li := NewLineItemWithMap(NewLineItemWithMap(seed).ToMap())
+		if id, ok := seed["id"].(float64); ok && model.Has(id) {
+			if !model.ReassignMergedIds {
+				model.removeLineItems(added...)
+				return SeedsErrorf("model[name=\"%s\"] has the id of seed: %v", model.Name, seed)
+			}
+			delete(li.dataMap, "id")
+		}
+
+		if err := model.Add(li); err != nil {
+			model.removeLineItems(added...)
+			return err
+		}
+		added = append(added, li)
+	}
+
+	model.backfillSeeds()
+	return nil
+}
+
+// removeLineItems removes the LineItems from Set without touching their related data
+func (model *Model) removeLineItems(lis ...LineItem) error {
+	model.Lock()
+	defer model.Unlock()
+
+	for _, li := range lis {
+		if err := model.Set.Remove(li.ID()); err != nil {
+			return err
+		}
+		model.removeUniqueValues(li)
+	}
+	return nil
+}
+
+// addLineItems adds the LineItems checked in a staged Model like Add under the lock, all of them or none,
+// so readers never see a part of them, returns the index of the LineItem failing the checks and the error
+func (model *Model) addLineItems(lis LineItems) (int, error) {
+	model.Lock()
+	defer model.Unlock()
+
+	if model.MaxRecords > 0 && model.Set.Len()+len(lis) > model.MaxRecords {
+		return 0, InsufficientStorageErrorf("model[name=\"%s\"] is full of %d items", model.Name, model.MaxRecords)
+	}
+	for i, li := range lis {
+		if model.Set.Has(li.ID()) {
+			return i, ConflictErrorf("model[name=\"%s\"] has the item[id=%v]", model.Name, li.Id())
+		}
+		if err := model.checkUniqueTogether(li.ToMap()); err != nil {
+			return i, err
+		}
+		if err := model.Validate(li.ToMap()); err != nil {
+			return i, err
+		}
+	}
+
+	for i, li := range lis {
+		if err := model.Set.Add(li); err != nil {
+			return i, err
+		}
 		model.addUniqueValues(li)
+		model.updateId(li.ID())
+		delete(model.tombstones, li.ID())
 	}
+	model.dataChanged = true
+	return 0, nil
+}
 
+// replaceLineItems replaces all LineItems of Set with the given checked ones under the lock,
+// the related data of the removed ones are kept
+func (model *Model) replaceLineItems(lis LineItems) error {
+	model.Lock()
+	defer model.Unlock()
+
+	if err := model.clearStorage(); err != nil {
+		return err
+	}
+	for _, column := range model.Columns {
+		column.uniqueValues = nil
+	}
+	for _, li := range lis {
+		if err := model.Set.Add(li); err != nil {
+			return err
+		}
+		model.addUniqueValues(li)
+		model.updateId(li.ID())
+		delete(model.tombstones, li.ID())
+	}
+	model.dataChanged = true
 	return nil
 }
 
-// Update updates the LineItem with the given id by the given LineItem
-func (model *Model) Update(id float64, li *LineItem) error {
-	oldLi, ok := model.Get(id)
-	if !ok {
-		return SeedsErrorf("model %s[id:%d] does not exsit", model.Name, id)
+// UpdateWithAttrsInGinContext finds a LineItem with id param,
+// updates it with attrs from the json or form request body,
+// returns the edited LineItem
+func (model *Model) UpdateWithAttrs(id float64, ctx *gin.Context) (LineItem, error) {
+	// check and write under the lock like Update
+	model.Lock()
+	defer model.Unlock()
+
+	// check if element does exsit
+	li, ok := model.Get(id)
+	if !ok {
+		return li, SeedsErrorf("model %s[id:%d] does not exsit", model.Name, id)
+	}
+
+	// check the values, then update model
+	values := map[*Column]interface{}{}
+	newMap := li.ToMap()
+	for _, column := range model.Columns {
+		if column.Name == "id" || model.isServerManaged(column) {
+			continue
+		}
+
+		formatVal, ok, err := postValue(ctx, column, model)
+		if err == nil && !ok {
+			continue
+		}
+		if err == nil {
+			err = column.CheckValue(formatVal, model)
+		}
+		if err != nil {
+			return li, err
+		}
+		values[column] = formatVal
+		newMap[column.Name] = formatVal
+	}
+	if err := model.checkUniqueTogether(newMap); err != nil {
+		return li, err
+	}
+
+	updated := NewLineItemWithMap(newMap)
+	if err := model.Set.Add(updated); err != nil {
+		return li, err
+	}
+	model.dataChanged = true
+	for column, formatVal := range values {
+		oldValue, _ := li.Get(column.Name)
+		column.RemoveUniquenessOf(oldValue)
+		column.AddUniquenessOf(formatVal)
+	}
+	return updated, nil
+}
+
+// UpdateWithMergePatch updates the LineItem with the given id by the JSON Merge Patch(RFC 7386) request body,
+// a null value removes the column which is not required on update, json columns are merged recursively,
+// nothing is changed if any value is wrong
+func (model *Model) UpdateWithMergePatch(id float64, ctx *gin.Context) (LineItem, error) {
+	model.Lock()
+	defer model.Unlock()
+
+	li, ok := model.Get(id)
+	if !ok {
+		return li, SeedsErrorf("model %s[id:%d] does not exsit", model.Name, id)
+	}
+
+	body, err := jsonBody(ctx)
+	if err != nil {
+		return li, err
+	}
+
+	// the new values of the patched columns, nil means removed
+	patched := map[*Column]interface{}{}
+	for _, column := range model.Columns {
+		if column.Name == "id" || model.isServerManaged(column) {
+			continue
+		}
+
+		name := column.Name
+		if _, ok := body[name]; !ok && column.Alias != "" {
+			name = column.Alias
+		}
+		patch, ok := body[name]
+		if !ok {
+			continue
+		}
+
+		if patch == nil {
+			if column.IsRequiredOn(UpdateAction) {
+				return li, withField(column.Name, UnprocessableErrorf("column[name=\"%s\"] is required and can not be removed", column.Name))
+			}
+			patched[column] = nil
+			continue
+		}
+
+		oldValue, _ := li.Get(column.Name)
+		value := patch
+		if column.Type == rawJSON.Name() {
+			value = mergePatch(oldValue, patch)
+		} else if value, err = formatPostValue(column, patch, model); err != nil {
+			return li, err
+		}
+
+		if reflect.DeepEqual(value, oldValue) {
+			continue
+		}
+		if err := column.CheckValue(value, model); err != nil {
+			return li, err
+		}
+		patched[column] = value
+	}
+
+	newMap := li.ToMap()
+	for column, value := range patched {
+		if value == nil {
+			delete(newMap, column.Name)
+		} else {
+			newMap[column.Name] = value
+		}
+	}
+	if err := model.checkUniqueTogether(newMap); err != nil {
+		return li, err
+	}
+
+	updated := NewLineItemWithMap(newMap)
+	if err := model.Set.Add(updated); err != nil {
+		return li, err
+	}
+	model.dataChanged = true
+	for column, value := range patched {
+		oldValue, _ := li.Get(column.Name)
+		column.RemoveUniquenessOf(oldValue)
+		if value != nil {
+			column.AddUniquenessOf(value)
+		}
+	}
+	return updated, nil
+}
+
+// isServerManaged returns if the column value is set by apifaker instead of the request body,
+// i.e. a slug or the SoftDelete column
+func (model *Model) isServerManaged(column *Column) bool {
+	return column.IsServerManaged() || (model.SoftDelete != "" && column.Name == model.SoftDelete)
+}
+
+// SimulatedStatus returns the status code in the StatusColumn of the LineItem and if it is set
+func (model *Model) SimulatedStatus(li LineItem) (int, bool) {
+	if model.StatusColumn == "" {
+		return 0, false
+	}
+	status, _ := li.Get(model.StatusColumn)
+	code, ok := status.(float64)
+	return int(code), ok && code >= 100 && code < 600
+}
+
+// IsDeleted returns if the LineItem is soft deleted
+func (model *Model) IsDeleted(li LineItem) bool {
+	if model.SoftDelete == "" {
+		return false
+	}
+	deleted, _ := li.Get(model.SoftDelete)
+	return deleted == true
+}
+
+// withoutDeleted returns the LineItems which are not soft deleted
+func (model *Model) withoutDeleted(lis LineItems) LineItems {
+	return lis.Filter(func(li LineItem) bool { return !model.IsDeleted(li) })
+}
+
+// setSlugs sets every slug column of li which has no value
+func (model *Model) setSlugs(li LineItem) {
+	for _, column := range model.Columns {
+		if _, ok := li.Get(column.Name); ok || column.Slugify == "" {
+			continue
+		}
+
+		source, _ := li.Get(column.Slugify)
+		li.Set(column.Name, column.nextSlug(source))
+	}
+}
+
+//------End Model CURD------//
+
+//------Idempotency------//
+type idempotencyRecord struct {
+	id        float64
+	createdAt time.Time
+}
+
+// ReserveIdempotencyKey returns the LineItem created with the given Idempotency-Key and true if the key has been used,
+// otherwise it reserves the key for the caller, who must call SetIdempotencyKey or ReleaseIdempotencyKey at last,
+// the requests with a reserved key wait until it is released, so only one of them creates the LineItem
+func (model *Model) ReserveIdempotencyKey(key string) (LineItem, bool) {
+	for {
+		model.Lock()
+		if done, ok := model.reservedKeys[key]; ok {
+			model.Unlock()
+			<-done
+			continue
+		}
+
+		// an unknown, expired or deleted one is used as a new key
+		ttl := time.Duration(model.IdempotencyTTL) * time.Millisecond
+		if record, ok := model.idempotencyKeys[key]; ok && (ttl <= 0 || time.Since(record.createdAt) <= ttl) {
+			if li, ok := model.Get(record.id); ok {
+				model.Unlock()
+				return li, true
+			}
+		}
+		delete(model.idempotencyKeys, key)
+
+		if model.reservedKeys == nil {
+			model.reservedKeys = map[string]chan struct{}{}
+		}
+		model.reservedKeys[key] = make(chan struct{})
+		model.Unlock()
+		return LineItem{}, false
+	}
+}
+
+// SetIdempotencyKey remembers the given Idempotency-Key for the created LineItem with id and releases it
+func (model *Model) SetIdempotencyKey(key string, id float64) {
+	model.Lock()
+	defer model.Unlock()
+
+	if model.idempotencyKeys == nil {
+		model.idempotencyKeys = map[string]idempotencyRecord{}
+	}
+	model.idempotencyKeys[key] = idempotencyRecord{id: id, createdAt: time.Now()}
+	model.releaseIdempotencyKey(key)
+}
+
+// ReleaseIdempotencyKey releases the given Idempotency-Key reserved by a failed create,
+// one of the waiting requests will reserve it then
+func (model *Model) ReleaseIdempotencyKey(key string) {
+	model.Lock()
+	defer model.Unlock()
+	model.releaseIdempotencyKey(key)
+}
+
+// releaseIdempotencyKey wakes up the requests waiting for the reserved key
+func (model *Model) releaseIdempotencyKey(key string) {
+	if done, ok := model.reservedKeys[key]; ok {
+		close(done)
+		delete(model.reservedKeys, key)
+	}
+}
+
+//------End Idempotency------//
+
+//------Consistency------//
+type pendingRecord struct {
+	visibleAt time.Time
+
+	// previous the version before the update, nil for a created item
+	previous *LineItem
+}
+
+// setPending makes the write of the LineItem with the given id invisible in ConsistencyDelay,
+// previous is the version before the update or nil for a created LineItem
+func (model *Model) setPending(id float64, previous *LineItem) {
+	if model.ConsistencyDelay <= 0 {
+		return
 	}
 
 	model.Lock()
 	defer model.Unlock()
 
-	// set id if the given LineItem has no id
-	if _, ok := li.Get("id"); !ok {
-		li.Set("id", id)
+	if model.pendings == nil {
+		model.pendings = map[float64]pendingRecord{}
 	}
-
-	if err := model.Validate(li.dataMap); err != nil {
-		return err
-	} else {
-		model.Set.Add(*li)
-		model.dataChanged = true
-		model.removeUniqueValues(oldLi)
-		model.addUniqueValues(*li)
+	// keep the oldest visible version for the writes in the delay
+	if record, ok := model.pendings[id]; ok && time.Now().Before(record.visibleAt) {
+		previous = record.previous
+	}
+	model.pendings[id] = pendingRecord{
+		visibleAt: time.Now().Add(time.Duration(model.ConsistencyDelay) * time.Millisecond),
+		previous:  previous,
 	}
-
-	return nil
 }
 
-// Delete deletes the LineItem and its related data with the given id
-func (model *Model) Delete(id float64) {
+// visible returns the version of the LineItem visible to GET and if it is visible
+func (model *Model) visible(li LineItem) (LineItem, bool) {
 	model.Lock()
 	defer model.Unlock()
 
-	li, ok := model.Get(id)
-
-	if !ok {
-		return
+	if record, ok := model.pendings[li.ID()]; ok && !time.Now().Before(record.visibleAt) {
+		delete(model.pendings, li.ID())
 	}
-
-	li.DeleteRelatedLis(id, model)
-	model.Set.Remove(gset.T(id))
-	model.dataChanged = true
-	model.removeUniqueValues(li)
+	return model.visibleVersion(li)
 }
 
-// UpdateWithAttrsInGinContext finds a LineItem with id param,
-// updates it with attrs from gin.Contex.PostForm(),
-// returns the edited LineItem
-func (model *Model) UpdateWithAttrs(id float64, ctx *gin.Context) (LineItem, error) {
-	// check if element does exsit
-	li, ok := model.Get(id)
-	if !ok {
-		return li, SeedsErrorf("model %s[id:%d] does not exsit", model.Name, id)
+// visibleVersion returns the version of the LineItem visible to GET and if it is visible like visible,
+// but keeps the expired records, so it could be called under the read lock
+func (model *Model) visibleVersion(li LineItem) (LineItem, bool) {
+	record, ok := model.pendings[li.ID()]
+	if !ok || !time.Now().Before(record.visibleAt) {
+		return li, true
+	}
+	if record.previous == nil {
+		return li, false
 	}
+	return *record.previous, true
+}
 
-	// update model
-	for _, column := range model.Columns {
-		value := ctx.PostForm(column.Name)
+// visibleLineItems returns the LineItems with related data visible to GET /collection,
+// without soft deleted and pending ones
+func (model *Model) visibleLineItems() LineItems {
+	// read under the lock so a replacing of all LineItems is seen at once
+	model.RLock()
+	all := model.lineItems()
+	model.RUnlock()
 
-		if value == "" || column.Name == "id" {
-			continue
+	lis := LineItems{}
+	for _, li := range model.withoutDeleted(all) {
+		if visibleLi, ok := model.visible(li); ok {
+			lis = append(lis, visibleLi.InsertRelatedData(model))
 		}
+	}
+	return lis
+}
 
-		formatVal, err := FormatValue(column.Type, value)
-		if err == nil {
-			err = column.CheckValue(formatVal, model)
-		}
+// eachVisible calls f with every LineItem visible to GET /collection without the related data until f returns false,
+// the Storage is iterated under the read lock so a replacing of all LineItems is seen at once
+func (model *Model) eachVisible(f func(li LineItem) bool) {
+	model.RLock()
+	defer model.RUnlock()
 
-		if err != nil {
-			return li, err
-		} else {
-			oldValue, _ := li.Get(column.Name)
-			column.RemoveUniquenessOf(oldValue)
-			li.Set(column.Name, formatVal)
-			column.AddUniquenessOf(formatVal)
+	model.Set.Iterate(func(li LineItem) bool {
+		if model.IsDeleted(li) {
+			return true
 		}
-	}
-	return li, nil
+		if visibleLi, ok := model.visibleVersion(li); ok {
+			return f(visibleLi)
+		}
+		return true
+	})
 }
 
-//------End Model CURD------//
+//------End Consistency------//
 
 //------Columns Uniqueness------//
 // addUniqueValues adds values of the Lineitem into corresponding Column's uniqueValues
@@ -255,6 +1291,8 @@ func (model *Model) CheckRelationshipsMeta() error {
 // checkColumnsMeta checks columns:
 //   1. id must be the first column, its type must be number
 //   2. CheckMeta
+//   3. slug columns, header columns, aliases, the StatusColumn and the SoftDelete column
+//   4. IdFormat must format and parse a number back
 func (model *Model) CheckColumnsMeta() error {
 	if len(model.Columns) < 1 ||
 		model.Columns[0].Name != "id" ||
@@ -262,32 +1300,180 @@ func (model *Model) CheckColumnsMeta() error {
 		return ColumnsErrorf("The first colmun must be id with number type in file: %s", model.router.filePath)
 	}
 
+	if model.IdFormat != "" {
+		idStr, _ := model.FormatId(42).(string)
+		if id, err := model.ParseId(idStr); err != nil || id != 42 {
+			return ColumnsErrorf("id_format %s must have a verb for an integer in file: %s", model.IdFormat, model.router.filePath)
+		}
+	}
+
 	for _, column := range model.Columns {
 		if err := column.CheckMeta(); err != nil {
 			return err
 		}
+
+		for _, name := range column.transformNames() {
+			if _, ok := model.transformFunc(name); !ok {
+				return ColumnsErrorf("column[name=\"%s\"] has unknown transform: %s in file: %s", column.Name, name, model.router.filePath)
+			}
+		}
+
+		if column.FromHeader != "" && (column.Name == "id" || column.Slugify != "") {
+			return ColumnsErrorf("column[name=\"%s\"] from_header can not be id or a slug column in file: %s", column.Name, model.router.filePath)
+		}
+
+		if column.Slugify != "" {
+			if _, ok := model.Column(column.Slugify); !ok || column.Type != str.Name() {
+				return ColumnsErrorf("column[name=\"%s\"] must be a string and slugify an existing column in file: %s", column.Name, model.router.filePath)
+			}
+		}
+	}
+
+	for _, column := range model.Columns {
+		if column.Alias == "" {
+			continue
+		}
+		for _, other := range model.Columns {
+			if other != column && (other.Name == column.Alias || other.Alias == column.Alias) {
+				return ColumnsErrorf("column[name=\"%s\"] alias %s has been used in file: %s", column.Name, column.Alias, model.router.filePath)
+			}
+		}
+	}
+
+	if model.StatusColumn != "" {
+		if column, ok := model.Column(model.StatusColumn); !ok || column.Type != number.Name() {
+			return ColumnsErrorf("status_column must be a number column in file: %s", model.router.filePath)
+		}
+	}
+
+	if model.SoftDelete != "" {
+		if column, ok := model.Column(model.SoftDelete); !ok || column.Type != boolean.Name() {
+			return ColumnsErrorf("soft_delete must be a boolean column in file: %s", model.router.filePath)
+		}
+	}
+
+	return nil
+}
+
+// CheckViewsMeta checks if every column of every view exists
+func (model *Model) CheckViewsMeta() error {
+	for view, columns := range model.Views {
+		for _, name := range columns {
+			if _, ok := model.Column(name); !ok {
+				return ColumnsErrorf("view \"%s\" has unknown column \"%s\" in file: %s", view, name, model.router.filePath)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckSingletonMeta checks if a singleton model has exactly one seed
+func (model *Model) CheckSingletonMeta() error {
+	if model.Singleton && len(model.Seeds) != 1 {
+		return SeedsErrorf("singleton model[name=\"%s\"] must have exactly one seed in file: %s", model.Name, model.router.filePath)
+	}
+	return nil
+}
+
+// CheckSeedsFileMeta checks if a model with seeds_file has no seeds or seed profiles and hot_items is not negative
+func (model *Model) CheckSeedsFileMeta() error {
+	if model.HotItems < 0 {
+		return SeedsErrorf("hot_items of model[name=\"%s\"] can not be negative in file: %s", model.Name, model.router.filePath)
+	}
+	if model.SeedsFile != "" && (len(model.Seeds) > 0 || len(model.SeedProfiles) > 0) {
+		return SeedsErrorf("model[name=\"%s\"] with seeds_file can not have seeds or seed_profiles in file: %s", model.Name, model.router.filePath)
+	}
+	return nil
+}
+
+// singletonId returns the id of the only LineItem of a singleton model and if it exists
+func (model *Model) singletonId() (float64, bool) {
+	lis := model.lineItems()
+	if len(lis) == 0 {
+		return 0, false
+	}
+	return lis[0].ID(), true
+}
+
+// CheckDelayMeta checks if every key of Delay is a method or "*" and every delay is non-negative
+func (model *Model) CheckDelayMeta() error {
+	for method, delay := range model.Delay {
+		switch method {
+		case "GET", "POST", "PUT", "PATCH", "DELETE", "*":
+		default:
+			return JsonFileErrorf("delay has unsupported method \"%s\" in model[name=\"%s\"]", method, model.Name)
+		}
+		if delay < 0 {
+			return JsonFileErrorf("delay of %s must be non-negative in model[name=\"%s\"]", method, model.Name)
+		}
+	}
+	return nil
+}
+
+// delayOf returns the delay of the given request method
+func (model *Model) delayOf(method string) time.Duration {
+	delay, ok := model.Delay[method]
+	if !ok {
+		delay = model.Delay["*"]
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// knowsAction returns if the given action is one of index, show, create, update and delete
+func (model *Model) knowsAction(action string) bool {
+	for _, knownAction := range allActions {
+		if action == knownAction {
+			return true
+		}
 	}
+	return false
+}
 
+// CheckActionsMeta checks if every element of Actions is a known action
+func (model *Model) CheckActionsMeta() error {
+	for _, action := range model.Actions {
+		if !model.knowsAction(action) {
+			return JsonFileErrorf("unknown action \"%s\" in model[name=\"%s\"], all actions: %v", action, model.Name, allActions)
+		}
+	}
 	return nil
 }
 
+// CheckOnDeleteMeta checks if OnDelete is empty or one of cascade, restrict and orphan
+func (model *Model) CheckOnDeleteMeta() error {
+	switch model.OnDelete {
+	case "", CascadeOnDelete, RestrictOnDelete, OrphanOnDelete:
+		return nil
+	}
+	return JsonFileErrorf("unknown on_delete \"%s\" in model[name=\"%s\"], it must be one of %s, %s and %s", model.OnDelete, model.Name, CascadeOnDelete, RestrictOnDelete, OrphanOnDelete)
+}
+
 // CheckRelationship
 //   1. checks if every resource in HasOne and HasMany exists
 //   2. CheckRelationships
 func (model *Model) CheckRelationship(seed map[string]interface{}) error {
+	// a Model not added to an ApiFaker like the generated one has no resources to check
+	if model.relatedRouters() == nil {
+		return nil
+	}
+
 	for _, resoureName := range model.HasOne {
-		if _, ok := model.router.apiFaker.Routers[inflection.Plural(resoureName)]; !ok {
+		if _, ok := model.relatedRouters()[inflection.Plural(resoureName)]; !ok {
 			return HasOneErrorf("use unknown reource %s in file: %s", resoureName, model.router.filePath)
 		}
 	}
 	for _, resoureName := range model.HasMany {
-		if _, ok := model.router.apiFaker.Routers[inflection.Plural(resoureName)]; !ok {
+		if _, ok := model.relatedRouters()[inflection.Plural(resoureName)]; !ok {
 			return HasManyErrorf("use unknown reource \"%s\" in file: %s", resoureName, model.router.filePath)
 		}
 	}
 
 	for _, column := range model.Columns {
-		if err := column.CheckRelationships(seed[column.Name], model); err != nil {
+		value, ok := seed[column.Name]
+		if !ok {
+			continue
+		}
+		if err := column.CheckRelationships(value, model); err != nil {
 			return err
 		}
 	}
@@ -309,13 +1495,18 @@ func (model *Model) CheckRelationships() error {
 func (model *Model) ValidateValue(seed map[string]interface{}) error {
 	columns := model.Columns
 
-	if len(seed) != len(columns) {
-		return SeedsErrorf("has wrong number of columns: %v", seed)
+	for key := range seed {
+		if _, ok := model.Column(key); !ok {
+			return withField(key, SeedsErrorf("has unknown column \"%s\" in seed: %v", key, seed))
+		}
 	}
 
 	for _, column := range columns {
 		if seedVal, ok := seed[column.Name]; !ok {
-			return SeedsErrorf("has no column \"%s\" in seed: %v", column.Name, seed)
+			// a column not required on create could be absent
+			if column.IsRequiredOn(CreateAction) {
+				return withField(column.Name, SeedsErrorf("has no column \"%s\" in seed: %v", column.Name, seed))
+			}
 		} else {
 			if err := column.CheckValue(seedVal, model); err != nil {
 				return err
@@ -326,6 +1517,53 @@ func (model *Model) ValidateValue(seed map[string]interface{}) error {
 	return nil
 }
 
+// MergeDefaults fills the omitted columns of every seed with Defaults,
+// every key of Defaults must be a column other than id
+func (model *Model) MergeDefaults() error {
+	for key := range model.Defaults {
+		if _, ok := model.Column(key); !ok || key == "id" {
+			return SeedsErrorf("defaults has unknown column \"%s\" in model[name=\"%s\"]", key, model.Name)
+		}
+	}
+
+	for _, seed := range model.Seeds {
+		for key, value := range model.Defaults {
+			if _, ok := seed[key]; !ok {
+				seed[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// NormalizeSeeds normalizes every value of seeds by its column,
+// the ids formatted by IdFormat are parsed to numbers
+func (model *Model) NormalizeSeeds() error {
+	for _, seed := range model.Seeds {
+		if idStr, ok := seed["id"].(string); ok && model.IdFormat != "" {
+			id, err := model.ParseId(idStr)
+			if err != nil {
+				return SeedsErrorf("%v in seed: %v", err, seed)
+			}
+			seed["id"] = id
+		}
+
+		for _, column := range model.Columns {
+			value, ok := seed[column.Name]
+			if !ok {
+				continue
+			}
+
+			normalized, err := column.Normalize(value, model)
+			if err != nil {
+				return err
+			}
+			seed[column.Name] = normalized
+		}
+	}
+	return nil
+}
+
 // ValidateSeedsValue
 func (model *Model) ValidateSeedsValue() error {
 	for _, seed := range model.Seeds {
@@ -346,20 +1584,58 @@ func (model *Model) Validate(seed map[string]interface{}) error {
 	}).Run()
 }
 
-// CheckUniqueness check uniqueness for initialization for ApiFaker
+// CheckUniqueness checks if any two items have the same id, value of a unique column or values of a group of UniqueTogether,
+// the seeds are checked before any change for the ones with the same id are one item of Set,
+// the error names the duplicated values and the indices of the items sorted by id or the seeds
 func (model *Model) CheckUniqueness() error {
-	// check id
-	if !model.dataChanged && len(model.Seeds) != model.Len() {
-		return SeedsErrorf("model[name=\"%s\"] has same id", model.Name)
+	if !model.dataChanged {
+		return model.checkDuplicates("seeds", model.Seeds)
 	}
+	return model.checkDuplicates("items", model.lineItems().ToSlice())
+}
+
+// CheckSeedsUniqueness checks the uniqueness of the seeds like CheckUniqueness
+func (model *Model) CheckSeedsUniqueness() error {
+	return model.checkDuplicates("seeds", model.Seeds)
+}
 
-	// check other unique columns
+// checkDuplicates returns an error naming the duplicated values and their indices like "seeds[0] and seeds[2]"
+// if any two of the items have the same id, value of a unique column or values of a group of UniqueTogether
+func (model *Model) checkDuplicates(name string, items []map[string]interface{}) error {
+	groups := [][]string{{"id"}}
 	for _, column := range model.Columns {
-		if column.Unique && column.uniqueValues.Len() != model.Len() {
-			return SeedsErrorf("column[name=\"%s\"] in model[name=\"%s\"] has same values", column.Name, model.Name)
+		if column.IsUnique() && column.Name != "id" {
+			groups = append(groups, []string{column.Name})
 		}
 	}
+	groups = append(groups, model.UniqueTogether...)
+
+	for _, group := range groups {
+		indices := map[string]int{}
+		for i, item := range items {
+			values := make([]interface{}, 0, len(group))
+			for _, columnName := range group {
+				if value, ok := item[columnName]; ok {
+					if column, ok := model.Column(columnName); ok {
+						value = column.uniqueKey(value)
+					}
+					values = append(values, value)
+				}
+			}
+			if len(values) < len(group) {
+				continue
+			}
 
+			key := fmt.Sprintf("%#v", values)
+			if j, ok := indices[key]; ok {
+				if len(group) == 1 {
+					return SeedsErrorf("model[name=\"%s\"] has duplicated %s %v in %s[%d] and %s[%d]", model.Name, group[0], values[0], name, j, name, i)
+				}
+				return SeedsErrorf("model[name=\"%s\"] has duplicated %v %v in %s[%d] and %s[%d]", model.Name, group, values, name, j, name, i)
+			}
+			indices[key] = i
+		}
+	}
 	return nil
 }
 
@@ -367,16 +1643,57 @@ func (model *Model) CheckUniqueness() error {
 
 //------Seeds and Set------//
 // initSet adds all LineItem into Set, addUniqueValues and updateId
-func (model *Model) initSet() {
+func (model *Model) initSet() error {
 	if model.Set == nil {
-		model.Set = gset.NewSetThreadSafe()
+		model.Set = NewMemoryStorage()
 	}
 	for _, seed := range model.Seeds {
 		li := NewLineItemWithMap(seed)
-		model.Set.Add(li)
+		if err := model.Set.Add(li); err != nil {
+			return err
+		}
+		model.addUniqueValues(li)
+		model.updateId(li.ID())
+	}
+	return nil
+}
+
+// seedsFilePath returns the path of SeedsFile, a relative one is joined to the directory of the json file
+func (model *Model) seedsFilePath() string {
+	if filepath.IsAbs(model.SeedsFile) {
+		return model.SeedsFile
+	}
+	return filepath.Join(filepath.Dir(model.router.filePath), model.SeedsFile)
+}
+
+// initSeedsFile sets a file-backed Storage of SeedsFile as the Set, every item of the file is validated like a seed
+func (model *Model) initSeedsFile() error {
+	if model.SeedsFile == "" {
+		return nil
+	}
+
+	hotItems := model.HotItems
+	if hotItems == 0 {
+		hotItems = defaultHotItems
+	}
+	storage, err := NewFileStorage(model.seedsFilePath(), hotItems)
+	if err != nil {
+		return err
+	}
+
+	storage.Iterate(func(li LineItem) bool {
+		if err = model.ValidateValue(li.ToMap()); err != nil {
+			return false
+		}
 		model.addUniqueValues(li)
 		model.updateId(li.ID())
+		return true
+	})
+	if err != nil {
+		return err
 	}
+	model.Set = storage
+	return nil
 }
 
 // backfillSeeds
@@ -384,29 +1701,214 @@ func (model *Model) backfillSeeds() {
 	model.RLock()
 	defer model.RUnlock()
 
-	models := model.ToLineItems()
-	sort.Sort(models)
-	model.Seeds = models.ToSlice()
+	// without the inserted related data
+	model.Seeds = model.lineItems().ToSlice()
+	model.dataChanged = false
+}
+
+// Reload re-reads the json file of the Model and replaces Seeds and the runtime data with its seeds,
+// the other meta like Columns are kept, the Model is unchanged if the file fails any check
+func (model *Model) Reload() error {
+	path := model.router.filePath
+	var loaded *Model
+	var err error
+	if model.router.combined {
+		loaded, err = combinedModel(path, model.Name, model.router.apiFaker)
+	} else if model.fsys != nil {
+		loaded, err = NewModelWithFS(model.fsys, path, model.router)
+	} else {
+		loaded, err = NewModelWithPath(path, model.router)
+	}
+	if err != nil {
+		return err
+	}
+
+	model.Lock()
+	defer model.Unlock()
+
+	for _, column := range model.Columns {
+		column.uniqueValues = nil
+	}
+	model.Seeds = loaded.Seeds
+	model.currentId = 0
+	if loaded.SeedsFile != "" {
+		// the writes kept over the file are dropped with the old Storage
+		model.Set = loaded.Set
+		model.Set.Iterate(func(li LineItem) bool {
+			model.addUniqueValues(li)
+			model.updateId(li.ID())
+			return true
+		})
+	} else {
+		if err := model.clearStorage(); err != nil {
+			return err
+		}
+		if err := model.initSet(); err != nil {
+			return err
+		}
+	}
 	model.dataChanged = false
+	model.idempotencyKeys = nil
+	model.pendings = nil
+	model.tombstones = nil
+	return nil
 }
 
 //------End Seeds and Set------//
 
+// lineItems returns the LineItems of Model sorted by id, without the related data
+func (model *Model) lineItems() LineItems {
+	lis := LineItems{}
+	model.Set.Iterate(func(li LineItem) bool {
+		lis = append(lis, li)
+		return true
+	})
+	sort.Sort(lis)
+	return lis
+}
+
+// clone allocates and returns a new Model of the given router with the same content of json file,
+// its data is initialized from Seeds, or the seeds of the given profile if the model declares it,
+// and shares nothing with the caller
+func (model *Model) clone(router *Router, profile string) (*Model, error) {
+	model.RLock()
+	bytes, err := json.Marshal(model)
+	model.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	newModel := NewModel(router)
+	if err := json.Unmarshal(bytes, newModel); err != nil {
+		return nil, err
+	}
+
+	if profile == emptySeedProfile {
+		newModel.Seeds = []map[string]interface{}{}
+		newModel.SeedsFile = ""
+	} else if seeds, ok := newModel.SeedProfiles[profile]; ok {
+		newModel.Seeds = seeds
+	} else if model.SeedsFile != "" {
+		// the router of the clone may have no json file to resolve the relative path
+		newModel.SeedsFile = model.seedsFilePath()
+	}
+
+	err = gtester.NewCheckQueue().
+		Add(newModel.MergeDefaults).
+		Add(newModel.NormalizeSeeds).
+		Add(newModel.ValidateSeedsValue).
+		Add(newModel.CheckSeedsUniqueness).
+		Add(newModel.initSeedsFile).
+		Add(newModel.initSet).
+		Run()
+	return newModel, err
+}
+
 // ToLineItems allocate a new LineItems filled with Model elements slice
 func (model *Model) ToLineItems() LineItems {
 	lis := []LineItem{}
-	elements := model.Set.ToSlice()
-	for _, element := range elements {
-		if li, ok := element.(LineItem); ok {
-			newLi := li.InsertRelatedData(model)
-			lis = append(lis[:], newLi)
+	model.Set.Iterate(func(li LineItem) bool {
+		lis = append(lis, li.InsertRelatedData(model))
+		return true
+	})
+	return LineItems(lis)
+}
+
+// Each calls f with every LineItem of Model in any order until f returns false,
+// the LineItems are not copied and have no related data, f must not write the Model for it runs under the read lock
+func (model *Model) Each(f func(li LineItem) bool) {
+	model.RLock()
+	defer model.RUnlock()
+
+	model.Set.Iterate(f)
+}
+
+// LastModified returns the time in "updated_at" of the LineItem and if it exists,
+// the value could be a date or datetime, a RFC3339 string or a number of unix seconds
+func (model *Model) LastModified(li LineItem) (t time.Time, ok bool) {
+	value, ok := li.Get("updated_at")
+	if !ok {
+		return
+	}
+
+	if column, found := model.Column("updated_at"); found && column.IsTime() {
+		return column.ParseTime(value)
+	}
+
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	case float64:
+		return time.Unix(int64(v), 0), true
+	}
+	return t, false
+}
+
+// Render returns the map of the LineItem for responses,
+// hidden columns are omitted and aliased columns use their aliases, including the ones of the inserted related data
+func (model *Model) Render(li LineItem) map[string]interface{} {
+	return model.renderMap(li.ToMap())
+}
+
+// RenderSlice returns the slice of maps of the LineItems for responses
+func (model *Model) RenderSlice(lis LineItems) []map[string]interface{} {
+	slice := []map[string]interface{}{}
+	for _, li := range lis {
+		slice = append(slice, model.Render(li))
+	}
+	return slice
+}
+
+// renderMap removes hidden columns, renames aliased columns and formats ids of model and the related models in the given map
+func (model *Model) renderMap(m map[string]interface{}) map[string]interface{} {
+	if id, ok := m["id"].(float64); ok {
+		m["id"] = model.FormatId(id)
+	}
+	for _, column := range model.Columns {
+		if column.Hidden {
+			delete(m, column.Name)
+		} else if value, ok := m[column.Name]; ok && column.Alias != "" {
+			delete(m, column.Name)
+			m[column.Alias] = value
 		}
 	}
-	return LineItems(lis)
+
+	routers := model.relatedRouters()
+	if routers == nil {
+		return m
+	}
+
+	for _, resName := range model.HasOne {
+		related, ok := m[inflection.Singular(resName)].(map[string]interface{})
+		if resRouter, found := routers[inflection.Plural(resName)]; ok && found {
+			m[inflection.Singular(resName)] = resRouter.Model.renderMap(related)
+		}
+	}
+	for _, resName := range model.HasMany {
+		related, ok := m[resName].([]interface{})
+		if resRouter, found := routers[resName]; ok && found {
+			for i, element := range related {
+				if elementMap, ok := element.(map[string]interface{}); ok {
+					related[i] = resRouter.Model.renderMap(elementMap)
+				}
+			}
+		}
+	}
+
+	return m
 }
 
-// SaveToFile save model to file with the given path
+// SaveToFile save model to file with the given path, compressed by gzip if the path ends with ".gz",
+// it returns an error for the Model loaded by NewModelWithFS
 func (model *Model) SaveToFile(path string) error {
+	if model.fsys != nil {
+		return JsonFileErrorf("model[name=\"%s\"] loaded from a fs.FS can not be saved to file: %s", model.Name, path)
+	}
+	if model.SeedsFile != "" {
+		return JsonFileErrorf("model[name=\"%s\"] with seeds_file can not be saved to file: %s", model.Name, path)
+	}
+
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -420,6 +1922,15 @@ func (model *Model) SaveToFile(path string) error {
 	if err != nil {
 		return err
 	}
+
+	// compress by gzip if the path ends with ".gz"
+	if strings.HasSuffix(path, ".gz") {
+		gzipWriter := gzip.NewWriter(file)
+		if _, err = gzipWriter.Write(bytes); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	}
 	_, err = file.WriteString(string(bytes))
 
 	return err
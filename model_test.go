@@ -1,8 +1,14 @@
 package apifaker
 
 import (
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -44,6 +50,30 @@ func TestModel(t *testing.T) {
 		})
 	})
 
+	Describ("FindBy", t, func() {
+		model := validBookModel()
+		Context("when find by an existing value", func() {
+			li, ok := model.FindBy("title", "Life of Pi")
+			It("returns the LineItem", func() {
+				Expect(ok, ShouldBeTrue)
+				Expect(li.ID(), ShouldEqual, float64(2))
+			})
+		})
+		Context("when find by a number in int", func() {
+			li, ok := model.FindBy("user_id", 1)
+			It("returns the first LineItem", func() {
+				Expect(ok, ShouldBeTrue)
+				Expect(li.ID(), ShouldEqual, float64(1))
+			})
+		})
+		Context("when find by an inexistent value", func() {
+			_, ok := model.FindBy("title", "Dune")
+			It("returns false", func() {
+				Expect(ok, ShouldBeFalse)
+			})
+		})
+	})
+
 	Describ("Uniqueness", t, func() {
 		Context("when check a user name already exists", func() {
 			model := validBookModel()
@@ -69,6 +99,61 @@ func TestModel(t *testing.T) {
 		})
 	})
 
+	Describ("UniqueCI", t, func() {
+		model := validUserModel()
+		column := &Column{Name: "email", Type: "string", UniqueCI: true}
+		column.AddUniquenessOf("A@x.com")
+		It("returns error for the value in different case", func() {
+			Expect(column.CheckValue("a@x.com", model), ShouldNotBeNil)
+			Expect(column.CheckValue("b@x.com", model), ShouldBeNil)
+		})
+	})
+
+	Describ("CheckSeedsUniqueness", t, func() {
+		Context("when two seeds have the same value of a unique column", func() {
+			model := validUserModel()
+			model.Seeds[2]["name"] = "Frank"
+			err := model.CheckSeedsUniqueness()
+			It("returns error naming the value and the indices", func() {
+				Expect(err, ShouldNotBeNil)
+				Expect(err.Error(), ShouldContainSubstring, "duplicated name Frank in seeds[0] and seeds[2]")
+			})
+		})
+
+		Context("when two seeds have the same id", func() {
+			model := validUserModel()
+			model.Seeds[1]["id"] = float64(1)
+			It("returns error", func() {
+				Expect(model.CheckSeedsUniqueness(), ShouldNotBeNil)
+			})
+		})
+
+		Context("when the seeds are unique", func() {
+			It("returns nil", func() {
+				Expect(validUserModel().CheckSeedsUniqueness(), ShouldBeNil)
+			})
+		})
+	})
+
+	Describ("CheckUniqueness", t, func() {
+		Context("when two seeds have the same id", func() {
+			model := validUserModel()
+			model.Seeds[1]["id"] = float64(1)
+			It("returns error naming the id and the indices", func() {
+				Expect(model.CheckUniqueness().Error(), ShouldContainSubstring, "duplicated id 1 in seeds[0] and seeds[1]")
+			})
+		})
+
+		Context("when two items have the same value of a unique column after changes", func() {
+			model := validUserModel()
+			model.Set.Add(LineItem{map[string]interface{}{"id": float64(4), "name": "Frank", "phone": "12332132140", "age": float64(21)}})
+			model.dataChanged = true
+			It("returns error naming the value and the indices", func() {
+				Expect(model.CheckUniqueness().Error(), ShouldContainSubstring, "duplicated name Frank in items[0] and items[3]")
+			})
+		})
+	})
+
 	Describ("CheckRelationshipsMeta", t, func() {
 		Context("when has_many has repeated elements", func() {
 			model := validUserModel()
@@ -148,6 +233,30 @@ func TestModel(t *testing.T) {
 		})
 	})
 
+	Describ("MergeDefaults", t, func() {
+		model := &Model{
+			Columns:  []*Column{{Name: "id", Type: "number"}, {Name: "active", Type: "boolean"}},
+			Defaults: map[string]interface{}{"active": true},
+			Seeds: []map[string]interface{}{
+				{"id": float64(1)},
+				{"id": float64(2), "active": false},
+			},
+		}
+		err := model.MergeDefaults()
+		It("fills the omitted columns only", func() {
+			Expect(err, ShouldBeNil)
+			Expect(model.Seeds[0]["active"], ShouldEqual, true)
+			Expect(model.Seeds[1]["active"], ShouldEqual, false)
+		})
+
+		Context("when defaults has an unknown column", func() {
+			model.Defaults["name"] = "Foci"
+			It("returns error", func() {
+				Expect(model.MergeDefaults(), ShouldNotBeNil)
+			})
+		})
+	})
+
 	Describ("ValidateSeedsValue", t, func() {
 		Context("when has wrong columns count", func() {
 			It("returns error", func() {
@@ -195,6 +304,737 @@ func TestModel(t *testing.T) {
 		})
 	})
 
+	Describ("Date column", t, func() {
+		model := validUserModel()
+		column := &Column{Name: "born_on", Type: "date", Format: "2006-01-02"}
+		Context("when value matches the format", func() {
+			It("returns nil", func() {
+				Expect(column.CheckValue("2016-02-29", model), ShouldBeNil)
+			})
+		})
+		Context("when value is not a valid date", func() {
+			err := column.CheckValue("2015-02-29", model)
+			It("returns an UnprocessableError", func() {
+				Expect(err, ShouldNotBeNil)
+				Expect(ErrorStatus(err), ShouldEqual, http.StatusUnprocessableEntity)
+			})
+		})
+	})
+
+	Describ("Decimal column", t, func() {
+		model := validUserModel()
+		column := &Column{Name: "price", Type: "decimal", Precision: 4, Scale: 2}
+		Context("when normalize a value", func() {
+			fromNumber, _ := column.Normalize(12.5, nil)
+			fromString, _ := column.Normalize("12.345", nil)
+			_, err := column.Normalize("12,5", nil)
+			It("returns a string with scale decimal places", func() {
+				Expect(fromNumber, ShouldEqual, "12.50")
+				Expect(fromString, ShouldEqual, "12.35")
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+		Context("when check a value", func() {
+			It("rejects the values exceeding the precision", func() {
+				Expect(column.CheckValue("12.50", model), ShouldBeNil)
+				Expect(column.CheckValue("123.45", model), ShouldNotBeNil)
+				Expect(column.CheckValue(12.5, model), ShouldNotBeNil)
+			})
+		})
+		Context("when scale is bigger than precision", func() {
+			It("returns error", func() {
+				Expect(Column{Name: "price", Type: "decimal", Precision: 1, Scale: 2}.CheckMeta(), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("Email column", t, func() {
+		model := validUserModel()
+		column := &Column{Name: "email", Type: "email"}
+		Context("when normalize a value", func() {
+			value, _ := column.Normalize("  Frank@Example.COM ", nil)
+			It("returns the trimmed and lowercased email", func() {
+				Expect(value, ShouldEqual, "frank@example.com")
+			})
+		})
+		Context("when check a value", func() {
+			It("rejects the wrong emails", func() {
+				Expect(column.CheckValue("frank@example.com", model), ShouldBeNil)
+				Expect(column.CheckValue("frank", model), ShouldNotBeNil)
+				Expect(column.CheckValue("Frank <frank@example.com>", model), ShouldNotBeNil)
+				Expect(ErrorStatus(column.CheckValue("frank@", model)), ShouldEqual, 422)
+			})
+		})
+	})
+
+	Describ("URL and UUID columns", t, func() {
+		model := validUserModel()
+		urlColumn := &Column{Name: "homepage", Type: "url"}
+		uuidColumn := &Column{Name: "uuid", Type: "uuid"}
+		It("rejects the wrong values", func() {
+			Expect(urlColumn.CheckValue("https://example.com/frank", model), ShouldBeNil)
+			Expect(ErrorStatus(urlColumn.CheckValue("example.com/frank", model)), ShouldEqual, 422)
+			Expect(urlColumn.CheckValue("https://", model), ShouldNotBeNil)
+			Expect(uuidColumn.CheckValue("123e4567-e89b-12d3-a456-426614174000", model), ShouldBeNil)
+			Expect(ErrorStatus(uuidColumn.CheckValue("123e4567e89b12d3a456426614174000", model)), ShouldEqual, 422)
+		})
+	})
+
+	Describ("JSON column", t, func() {
+		model := validUserModel()
+		column := &Column{Name: "metadata", Type: "json"}
+		Context("when value is any json value", func() {
+			It("returns nil", func() {
+				Expect(column.CheckValue(map[string]interface{}{"tags": []interface{}{"a"}}, model), ShouldBeNil)
+				Expect(column.CheckValue(nil, model), ShouldBeNil)
+			})
+		})
+		Context("when format a form value", func() {
+			value, err := FormatValue("json", `{"vip": true}`)
+			_, wrongErr := FormatValue("json", `{vip}`)
+			It("decodes it as json", func() {
+				Expect(err, ShouldBeNil)
+				Expect(value, ShouldResemble, map[string]interface{}{"vip": true})
+				Expect(wrongErr, ShouldNotBeNil)
+			})
+		})
+		Context("when column is unique", func() {
+			It("returns error", func() {
+				Expect(Column{Name: "metadata", Type: "json", Unique: true}.CheckMeta(), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("RouteName", t, func() {
+		It("uses the route, the plural or the name", func() {
+			Expect((&Model{Name: "person"}).RouteName(), ShouldEqual, "person")
+			Expect((&Model{Name: "person", Pluralize: true}).RouteName(), ShouldEqual, "people")
+			Expect((&Model{Name: "person", Pluralize: true, Route: "persons"}).RouteName(), ShouldEqual, "persons")
+		})
+	})
+
+	Describ("LineItems.Filter", t, func() {
+		lis := LineItems{
+			NewLineItemWithMap(map[string]interface{}{"id": float64(1), "user_id": float64(1)}),
+			NewLineItemWithMap(map[string]interface{}{"id": float64(2), "user_id": float64(2)}),
+			NewLineItemWithMap(map[string]interface{}{"id": float64(3), "user_id": float64(1)}),
+		}
+		filtered := lis.Filter(func(li LineItem) bool {
+			userId, _ := li.Get("user_id")
+			return userId == float64(1)
+		})
+		It("returns the matched items in order", func() {
+			Expect(filtered.Len(), ShouldEqual, 2)
+			Expect(filtered[0].ID(), ShouldEqual, float64(1))
+			Expect(filtered[1].ID(), ShouldEqual, float64(3))
+		})
+	})
+
+	Describ("filterByDateRange", t, func() {
+		model := validBookModel()
+		model.Columns = append(model.Columns, &Column{Name: "published_on", Type: "date"})
+		lis := LineItems{
+			NewLineItemWithMap(map[string]interface{}{"id": float64(1), "published_on": "2016-01-01"}),
+			NewLineItemWithMap(map[string]interface{}{"id": float64(2), "published_on": "2016-06-01"}),
+			NewLineItemWithMap(map[string]interface{}{"id": float64(3)}),
+		}
+
+		Context("when pass a range", func() {
+			filtered, err := model.filterByDateRange(lis, url.Values{
+				"published_on_after":  {"2016-03-01"},
+				"published_on_before": {"2016-06-01"},
+			})
+			It("returns items in the range", func() {
+				Expect(err, ShouldBeNil)
+				Expect(filtered.Len(), ShouldEqual, 1)
+				Expect(filtered[0].ID(), ShouldEqual, float64(2))
+			})
+		})
+
+		Context("when pass a malformed bound", func() {
+			_, err := model.filterByDateRange(lis, url.Values{"published_on_after": {"March"}})
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("Slugify", t, func() {
+		model := validBookModel()
+		model.Columns = append(model.Columns, &Column{Name: "slug", Type: "string", Unique: true, Slugify: "title"})
+		first := NewLineItemWithMap(map[string]interface{}{"title": "Hello World", "user_id": float64(1)})
+		second := NewLineItemWithMap(map[string]interface{}{"title": "Hello, World!", "user_id": float64(1)})
+		model.Add(first)
+		model.Add(second)
+		firstSlug, _ := first.Get("slug")
+		secondSlug, _ := second.Get("slug")
+		It("sets slugs from title with numeric suffix for used ones", func() {
+			Expect(firstSlug, ShouldEqual, "hello-world")
+			Expect(secondSlug, ShouldEqual, "hello-world-2")
+		})
+
+		Context("when an alias is the name of another column", func() {
+			model := validBookModel()
+			model.Columns[1].Alias = "user_id"
+			It("returns error", func() {
+				Expect(model.CheckColumnsMeta(), ShouldNotBeNil)
+			})
+		})
+
+		Context("when slugify an unknown column", func() {
+			model := validBookModel()
+			model.Columns = append(model.Columns, &Column{Name: "slug", Type: "string", Slugify: "name"})
+			It("returns error", func() {
+				Expect(model.CheckColumnsMeta(), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("MergeSeeds", t, func() {
+		other := &Model{Seeds: []map[string]interface{}{
+			{"id": float64(4), "title": "Dune", "user_id": float64(1)},
+			{"id": float64(1), "title": "Emma", "user_id": float64(2)},
+		}}
+
+		Context("when an id has been used", func() {
+			model := validBookModel()
+			err := model.MergeSeeds(other)
+			It("returns error and merges nothing", func() {
+				Expect(err, ShouldNotBeNil)
+				Expect(model.Len(), ShouldEqual, 3)
+			})
+		})
+
+		Context("when ReassignMergedIds is true", func() {
+			model := validBookModel()
+			model.ReassignMergedIds = true
+			err := model.MergeSeeds(other)
+			It("gives the seed a new id", func() {
+				Expect(err, ShouldBeNil)
+				Expect(model.Len(), ShouldEqual, 5)
+				li, _ := model.FindBy("title", "Emma")
+				Expect(li.ID(), ShouldEqual, float64(5))
+				Expect(len(model.Seeds), ShouldEqual, 5)
+			})
+		})
+
+		Context("when a seed is wrong", func() {
+			model := validBookModel()
+			err := model.MergeSeeds(&Model{Seeds: []map[string]interface{}{
+				{"id": float64(4), "title": "Dune", "user_id": float64(1)},
+				{"id": float64(5), "title": "Dune", "user_id": float64(1)},
+			}})
+			It("returns error and merges nothing", func() {
+				Expect(err, ShouldNotBeNil)
+				Expect(model.Len(), ShouldEqual, 3)
+			})
+		})
+	})
+
+	Describ("GenerateModelFromSample", t, func() {
+		model, err := GenerateModelFromSample("articles", map[string]interface{}{
+			"title":     "Hello",
+			"views":     10,
+			"published": true,
+			"tags":      []interface{}{"go"},
+			"author":    map[string]interface{}{"name": "Foci"},
+		})
+		It("infers columns from the sample", func() {
+			Expect(err, ShouldBeNil)
+			Expect(model.Columns[0].Name, ShouldEqual, "id")
+			types := map[string]string{}
+			for _, column := range model.Columns {
+				types[column.Name] = column.Type
+			}
+			Expect(types, ShouldResemble, map[string]string{
+				"id":        "number",
+				"title":     "string",
+				"views":     "number",
+				"published": "boolean",
+				"tags":      "array",
+				"author":    "object",
+			})
+			Expect(model.Len(), ShouldEqual, 1)
+		})
+
+		It("uses the sample values as examples", func() {
+			column, _ := model.Column("title")
+			Expect(column.Example, ShouldEqual, "Hello")
+		})
+
+		Context("when the sample has a foreign key", func() {
+			model, err := GenerateModelFromSample("books", map[string]interface{}{"title": "A", "user_id": 1})
+			added := model.Add(NewLineItemWithMap(map[string]interface{}{"title": "B", "user_id": float64(2)}))
+			It("infers a number column without checking the relationship", func() {
+				Expect(err, ShouldBeNil)
+				Expect(added, ShouldBeNil)
+				column, _ := model.Column("user_id")
+				Expect(column.Type, ShouldEqual, "number")
+				Expect(model.Delete(1), ShouldBeNil)
+			})
+		})
+
+		Context("when the id of sample is not a number", func() {
+			_, err := GenerateModelFromSample("articles", map[string]interface{}{"id": "a"})
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("Intersect, Union and Difference", t, func() {
+		model, _ := GenerateModelFromSample("books", map[string]interface{}{"id": 1, "title": "A"})
+		model.Add(NewLineItemWithMap(map[string]interface{}{"id": float64(2), "title": "B"}))
+		other, _ := GenerateModelFromSample("books", map[string]interface{}{"id": 2, "title": "B2"})
+		other.Add(NewLineItemWithMap(map[string]interface{}{"id": float64(3), "title": "C"}))
+
+		ids := func(lis LineItems) []float64 {
+			result := []float64{}
+			for _, li := range lis {
+				result = append(result, li.ID())
+			}
+			return result
+		}
+
+		It("returns the LineItems by id", func() {
+			Expect(ids(model.Intersect(other)), ShouldResemble, []float64{2})
+			Expect(ids(model.Union(other)), ShouldResemble, []float64{1, 2, 3})
+			Expect(ids(model.Difference(other)), ShouldResemble, []float64{1})
+		})
+
+		It("keeps the LineItems of model in Union", func() {
+			Expect(model.Union(other)[1].dataMap["title"], ShouldEqual, "B")
+		})
+	})
+
+	Describ("Column.Transform", t, func() {
+		column := &Column{Name: "email", Type: "string", Transform: "trim,lower"}
+		It("transforms the string value in order", func() {
+			value, err := column.Normalize("  Foci@Example.COM ", nil)
+			Expect(err, ShouldBeNil)
+			Expect(value, ShouldEqual, "foci@example.com")
+		})
+
+		Context("when the transform is custom", func() {
+			model := validUserModel()
+			model.router.apiFaker.RegisterTransform("digits", func(s string) string {
+				return strings.Map(func(r rune) rune {
+					if r >= '0' && r <= '9' {
+						return r
+					}
+					return -1
+				}, s)
+			})
+			column, _ := model.Column("phone")
+			column.Transform = "digits"
+			value, _ := column.Normalize("132-1321-3214", model)
+			It("uses the function registered to the ApiFaker of the model", func() {
+				Expect(model.CheckColumnsMeta(), ShouldBeNil)
+				Expect(value, ShouldEqual, "13213213214")
+			})
+
+			It("is not available to other ApiFakers", func() {
+				other := validUserModel()
+				column, _ := other.Column("phone")
+				column.Transform = "digits"
+				Expect(other.CheckColumnsMeta(), ShouldNotBeNil)
+			})
+		})
+
+		Context("when the transform is unknown", func() {
+			model := validUserModel()
+			column, _ := model.Column("name")
+			column.Transform = "reverse"
+			It("returns error", func() {
+				Expect(model.CheckColumnsMeta(), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("IdFormat", t, func() {
+		model := &Model{IdFormat: "USR-%05d"}
+		It("formats and parses ids", func() {
+			Expect(model.FormatId(42), ShouldEqual, "USR-00042")
+			id, err := model.ParseId("USR-00042")
+			Expect(err, ShouldBeNil)
+			Expect(id, ShouldEqual, float64(42))
+		})
+
+		Context("when the id does not match", func() {
+			_, err := model.ParseId("42")
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("Reload", t, func() {
+		model := validUserModel()
+		model.Add(LineItem{map[string]interface{}{
+			"id":    float64(4),
+			"name":  "Monica",
+			"phone": "12332132132",
+			"age":   float64(21),
+		}})
+		err := model.Reload()
+		It("replaces the data with the seeds in the file", func() {
+			Expect(err, ShouldBeNil)
+			Expect(model.Len(), ShouldEqual, 3)
+			Expect(model.Has(4), ShouldBeFalse)
+			Expect(model.dataChanged, ShouldBeFalse)
+		})
+
+		Context("when the file is wrong", func() {
+			model := validUserModel()
+			model.Add(LineItem{map[string]interface{}{
+				"id":    float64(4),
+				"name":  "Monica",
+				"phone": "12332132132",
+				"age":   float64(21),
+			}})
+			model.router = &Router{apiFaker: model.router.apiFaker, filePath: testDir + "/nonexistent.json"}
+			err := model.Reload()
+			It("returns error and keeps the data", func() {
+				Expect(err, ShouldNotBeNil)
+				Expect(model.Len(), ShouldEqual, 4)
+			})
+		})
+	})
+
+	Describ("SetStorage", t, func() {
+		model := validUserModel()
+		storage := NewMemoryStorage()
+		model.SetStorage(storage)
+		It("copies the data into the empty storage", func() {
+			Expect(storage.Len(), ShouldEqual, 3)
+			Expect(model.Has(1), ShouldBeTrue)
+		})
+
+		Context("when Add", func() {
+			err := model.Add(LineItem{map[string]interface{}{
+				"id":    float64(4),
+				"name":  "Monica",
+				"phone": "12332132132",
+				"age":   float64(21),
+			}})
+			It("adds into the storage", func() {
+				Expect(err, ShouldBeNil)
+				Expect(storage.Has(4), ShouldBeTrue)
+			})
+		})
+
+		Context("when the storage has data", func() {
+			other := validUserModel()
+			other.SetStorage(storage)
+			It("keeps the data of the storage", func() {
+				Expect(other.Len(), ShouldEqual, 4)
+				Expect(other.currentId, ShouldEqual, 4)
+			})
+		})
+	})
+
+	Describ("seeds_file", t, func() {
+		dir, _ := ioutil.TempDir("", "seeds")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "users.json")
+		ioutil.WriteFile(path, []byte(`{
+			"resource_name": "users",
+			"seeds_file": "users.jsonl",
+			"hot_items": 2,
+			"columns": [
+				{"name": "id", "type": "number"},
+				{"name": "name", "type": "string", "unique": true},
+				{"name": "phone", "type": "string", "unique": true},
+				{"name": "age", "type": "number"}
+			]
+		}`), 0644)
+		lines := ""
+		for id := 1; id <= 5; id++ {
+			lines += fmt.Sprintf("{\"id\": %d, \"name\": \"user%d\", \"phone\": \"1233213213%d\", \"age\": 22}\n", id, id, id)
+		}
+		ioutil.WriteFile(filepath.Join(dir, "users.jsonl"), []byte(lines), 0644)
+
+		model, err := NewModelWithPath(path, &Router{apiFaker: &ApiFaker{}, filePath: path})
+		It("indexes the file without keeping the items", func() {
+			Expect(err, ShouldBeNil)
+			Expect(model.Len(), ShouldEqual, 5)
+			Expect(model.currentId, ShouldEqual, 5)
+			Expect(len(model.Set.(*fileStorage).hot), ShouldEqual, 0)
+		})
+
+		Context("when List and FindBy", func() {
+			query, _ := model.NewQuery(url.Values{"limit": {"2"}, "offset": {"1"}})
+			page, listErr := model.List(query)
+			li, ok := model.FindBy("name", "user4")
+			It("iterates the file without keeping the items", func() {
+				Expect(listErr, ShouldBeNil)
+				Expect(page.Total, ShouldEqual, 5)
+				Expect(page.LineItems, ShouldHaveLength, 2)
+				Expect(page.LineItems[0].ToMap()["name"], ShouldEqual, "user2")
+				Expect(ok, ShouldBeTrue)
+				Expect(li.ID(), ShouldEqual, 4)
+				Expect(len(model.Set.(*fileStorage).hot), ShouldEqual, 0)
+			})
+		})
+
+		Context("when Get", func() {
+			for id := 1; id <= 3; id++ {
+				model.Get(float64(id))
+			}
+			li, ok := model.Get(5)
+			It("reads the item and keeps only hot_items items", func() {
+				Expect(ok, ShouldBeTrue)
+				Expect(li.ToMap()["name"], ShouldEqual, "user5")
+				Expect(len(model.Set.(*fileStorage).hot), ShouldEqual, 2)
+			})
+		})
+
+		Context("when Add, Update and Delete", func() {
+			addErr := model.Add(LineItem{map[string]interface{}{"name": "Monica", "phone": "12332132140", "age": float64(21)}})
+			updateErr := model.Update(1, &LineItem{map[string]interface{}{"name": "Ross", "phone": "12332132141", "age": float64(30)}})
+			duplicateErr := model.Add(LineItem{map[string]interface{}{"name": "user3", "phone": "12332132142", "age": float64(21)}})
+			deleteErr := model.Delete(2)
+			li, _ := model.Get(1)
+			It("keeps the writes over the file and checks the uniqueness of its items", func() {
+				Expect(addErr, ShouldBeNil)
+				Expect(updateErr, ShouldBeNil)
+				Expect(duplicateErr, ShouldNotBeNil)
+				Expect(deleteErr, ShouldBeNil)
+				Expect(li.ToMap()["name"], ShouldEqual, "Ross")
+				Expect(model.Has(2), ShouldBeFalse)
+				Expect(model.Has(6), ShouldBeTrue)
+				Expect(model.Len(), ShouldEqual, 5)
+				Expect(model.lineItems()[0].ToMap()["name"], ShouldEqual, "Ross")
+			})
+
+			Context("when Reload", func() {
+				err := model.Reload()
+				It("drops the writes", func() {
+					Expect(err, ShouldBeNil)
+					Expect(model.Len(), ShouldEqual, 5)
+					Expect(model.Has(2), ShouldBeTrue)
+					Expect(model.Has(6), ShouldBeFalse)
+				})
+			})
+		})
+
+		Context("when an item is wrong", func() {
+			ioutil.WriteFile(filepath.Join(dir, "users.jsonl"), []byte(lines+"{\"id\": 6, \"name\": \"user1\", \"phone\": \"12332132146\", \"age\": 22}\n"), 0644)
+			_, err := NewModelWithPath(path, &Router{apiFaker: &ApiFaker{}, filePath: path})
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+
+		Context("when a line has no id", func() {
+			ioutil.WriteFile(filepath.Join(dir, "users.jsonl"), []byte("{\"name\": \"Frank\"}\n"), 0644)
+			_, err := NewModelWithPath(path, &Router{apiFaker: &ApiFaker{}, filePath: path})
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("NewQuery and List", t, func() {
+		model := validUserModel()
+		Context("when the params are right", func() {
+			query, err := model.NewQuery(url.Values{"age": {"22"}, "include": {"books"}, "limit": {"2"}, "offset": {"1"}}, QueryFilters, QueryInclude)
+			page, listErr := model.List(query)
+			It("lists the filtered page", func() {
+				Expect(err, ShouldBeNil)
+				Expect(query.Filters, ShouldResemble, map[string]string{"age": "22"})
+				Expect(query.Include, ShouldResemble, []string{"books"})
+				Expect(listErr, ShouldBeNil)
+				Expect(page.Total, ShouldEqual, 3)
+				Expect(page.LineItems.Len(), ShouldEqual, 2)
+				Expect(page.LineItems[0].ID(), ShouldEqual, 2)
+			})
+		})
+
+		Context("when no feature is given", func() {
+			query, err := model.NewQuery(url.Values{"age": {"23"}, "include": {"books"}})
+			page, _ := model.List(query)
+			It("does not parse the filters and include", func() {
+				Expect(err, ShouldBeNil)
+				Expect(query.Filters, ShouldBeNil)
+				Expect(query.Include, ShouldBeNil)
+				Expect(page.Total, ShouldEqual, 3)
+			})
+		})
+
+		Context("when sort and fields are given", func() {
+			query, err := model.NewQuery(url.Values{"sort": {"-name"}, "fields": {"name"}})
+			page, listErr := model.List(query)
+			It("sorts the items and responds the fields only", func() {
+				Expect(err, ShouldBeNil)
+				Expect(query.Sort, ShouldResemble, []string{"-name"})
+				Expect(query.Fields, ShouldResemble, []string{"name"})
+				Expect(listErr, ShouldBeNil)
+				Expect(page.LineItems.ToSlice(), ShouldResemble, []map[string]interface{}{
+					{"id": float64(1), "name": "Frank"},
+					{"id": float64(3), "name": "Foci"},
+					{"id": float64(2), "name": "Antony"},
+				})
+			})
+		})
+
+		Context("when sort by a date column not in ISO format", func() {
+			dated := validUserModel()
+			dated.Columns = append(dated.Columns, &Column{Name: "born_on", Type: "date", Format: "01/02/2006"})
+			for id, bornOn := range map[float64]string{1: "12/31/1999", 2: "01/15/2001", 3: "06/01/2000"} {
+				li, _ := dated.Get(id)
+				li.Set("born_on", bornOn)
+			}
+			query, _ := dated.NewQuery(url.Values{"sort": {"born_on"}})
+			page, err := dated.List(query)
+			It("sorts the items chronologically", func() {
+				Expect(err, ShouldBeNil)
+				Expect(page.LineItems.Len(), ShouldEqual, 3)
+				Expect(page.LineItems[0].ID(), ShouldEqual, 1)
+				Expect(page.LineItems[1].ID(), ShouldEqual, 3)
+				Expect(page.LineItems[2].ID(), ShouldEqual, 2)
+			})
+		})
+
+		Context("when a param is malformed", func() {
+			_, limitErr := model.NewQuery(url.Values{"limit": {"-1"}})
+			_, afterErr := model.NewQuery(url.Values{"after": {"Mw=="}, "offset": {"1"}})
+			_, sortErr := model.NewQuery(url.Values{"sort": {"-nothing"}})
+			_, fieldsErr := model.NewQuery(url.Values{"fields": {"nothing"}})
+			_, cursorErr := model.NewQuery(url.Values{"after": {"Mw=="}, "sort": {"name"}})
+			It("returns error", func() {
+				Expect(limitErr, ShouldNotBeNil)
+				Expect(afterErr, ShouldNotBeNil)
+				Expect(sortErr, ShouldNotBeNil)
+				Expect(fieldsErr, ShouldNotBeNil)
+				Expect(cursorErr, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Describ("Delete", t, func() {
+		model := validUserModel()
+		model.OnDelete = OrphanOnDelete
+		It("returns a NotFoundError for a missing item", func() {
+			Expect(model.Delete(3), ShouldBeNil)
+			Expect(ErrorStatus(model.Delete(3)), ShouldEqual, http.StatusNotFound)
+			Expect(ErrorStatus(model.Delete(100)), ShouldEqual, http.StatusNotFound)
+		})
+	})
+
+	Describ("Each", t, func() {
+		model := validUserModel()
+		count := 0
+		model.Each(func(li LineItem) bool {
+			count++
+			return true
+		})
+		stopped := 0
+		model.Each(func(li LineItem) bool {
+			stopped++
+			return false
+		})
+		It("iterates every item until the callback returns false", func() {
+			Expect(count, ShouldEqual, 3)
+			Expect(stopped, ShouldEqual, 1)
+		})
+	})
+
+	Describ("ExportCSV", t, func() {
+		model := validUserModel()
+		builder := &strings.Builder{}
+		err := model.ExportCSV(builder)
+		It("writes a header row and the items sorted by id", func() {
+			Expect(err, ShouldBeNil)
+			Expect(builder.String(), ShouldEqual, "id,name,phone,age\n"+
+				"1,Frank,13213213213,22\n"+
+				"2,Antony,13213213211,22\n"+
+				"3,Foci,13213213212,22\n")
+		})
+	})
+
+	Describ("NewModelsWithPath", t, func() {
+		dir, _ := ioutil.TempDir("", "apifaker")
+		defer os.RemoveAll(dir)
+		columns := `"columns": [{"name": "id", "type": "number"}, {"name": "label", "type": "string"}]`
+
+		Context("when the file is an object of models", func() {
+			path := dir + "/models.json"
+			ioutil.WriteFile(path, []byte(`{"tags": {`+columns+`, "seeds": [{"id": 1, "label": "go"}]}, "colors": {`+columns+`, "seeds": []}}`), 0644)
+			models, err := NewModelsWithPath(path, testRouter.apiFaker)
+			It("returns the models sorted by name", func() {
+				Expect(err, ShouldBeNil)
+				Expect(len(models), ShouldEqual, 2)
+				Expect(models[0].Name, ShouldEqual, "colors")
+				Expect(models[1].Len(), ShouldEqual, 1)
+				Expect(models[1].router.SaveToFile(), ShouldNotBeNil)
+			})
+
+			faker, err := NewWithApiDir(dir)
+			It("registers every model of the directory", func() {
+				Expect(err, ShouldBeNil)
+				Expect(len(faker.Routers), ShouldEqual, 2)
+				Expect(faker.Routers["tags"].filePath, ShouldEqual, path)
+			})
+
+			Context("when Reload", func() {
+				model := faker.Routers["tags"].Model
+				model.Add(LineItem{map[string]interface{}{"label": "rust"}})
+				err := model.Reload()
+				It("reloads the seeds of the model from the combined file", func() {
+					Expect(err, ShouldBeNil)
+					Expect(model.Len(), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Context("when a model of the file is wrong", func() {
+			path := dir + "/views.json"
+			ioutil.WriteFile(path, []byte(`{"tags": {`+columns+`, "views": {"short": ["nothing"]}}}`), 0644)
+			defer os.Remove(path)
+			_, err := NewModelsWithPath(path, testRouter.apiFaker)
+			It("returns error with the file path", func() {
+				Expect(err.Error(), ShouldContainSubstring, "in file: "+path)
+			})
+		})
+
+		Context("when the file is an array of models", func() {
+			path := dir + "/array.json"
+			ioutil.WriteFile(path, []byte(`[{"resource_name": "tags", `+columns+`, "seeds": [{"id": 1, "label": 1}]}]`), 0644)
+			defer os.Remove(path)
+			_, err := NewModelsWithPath(path, testRouter.apiFaker)
+			It("checks every model", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+
+		Context("when the file is a single model", func() {
+			models, err := NewModelsWithPath(testDir+"/users.json", testRouter.apiFaker)
+			It("returns the model", func() {
+				Expect(err, ShouldBeNil)
+				Expect(len(models), ShouldEqual, 1)
+				Expect(models[0].router.filePath, ShouldEqual, testDir+"/users.json")
+			})
+		})
+	})
+
+	Describ("NewModelWithFS", t, func() {
+		model, err := NewModelWithFS(os.DirFS(testDir), "users.json", testRouter)
+		It("loads the model from the fs.FS", func() {
+			Expect(err, ShouldBeNil)
+			Expect(model.Len(), ShouldEqual, validUserModel().Len())
+		})
+
+		Context("when SaveToFile", func() {
+			path := testDir + "/users_fs.json.test"
+			err := model.SaveToFile(path)
+			defer os.Remove(path)
+			It("returns error", func() {
+				Expect(err, ShouldNotBeNil)
+			})
+		})
+	})
+
 	Describ("SaveToFile", t, func() {
 		model := validUserModel()
 		err := model.Add(LineItem{map[string]interface{}{
@@ -213,5 +1053,17 @@ func TestModel(t *testing.T) {
 		It("saves to file", func() {
 			Expect(err, ShouldBeNil)
 		})
+
+		Context("when the path ends with .gz", func() {
+			path := testDir + "/users_temp.json.test.gz"
+			err := model.SaveToFile(path)
+			defer os.Remove(path)
+			loaded, loadErr := NewModelWithPath(path, model.router)
+			It("saves and loads the gzip file", func() {
+				Expect(err, ShouldBeNil)
+				Expect(loadErr, ShouldBeNil)
+				Expect(loaded.Len(), ShouldEqual, model.Len())
+			})
+		})
 	})
 }
@@ -0,0 +1,80 @@
+package apifaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// orderedMap is a map marshaled as a json object with the keys in order
+type orderedMap struct {
+	keys []string
+	m    map[string]interface{}
+}
+
+// MarshalJSON implements json.Marshaler
+func (om orderedMap) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, key := range om.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyBytes, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueBytes, err := json.Marshal(om.m[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyBytes)
+		buf.WriteByte(':')
+		buf.Write(valueBytes)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ordered returns the rendered map with the keys in the order of Columns,
+// the keys of no column like the related data follow them in alphabetical order
+func (model *Model) ordered(m map[string]interface{}) orderedMap {
+	om := orderedMap{m: m}
+	known := map[string]bool{}
+	for _, column := range model.Columns {
+		key := column.Name
+		if column.Alias != "" {
+			key = column.Alias
+		}
+		if _, ok := m[key]; ok && !known[key] {
+			om.keys = append(om.keys, key)
+			known[key] = true
+		}
+	}
+
+	others := []string{}
+	for key := range m {
+		if !known[key] {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+	om.keys = append(om.keys, others...)
+	return om
+}
+
+// orderedJSON returns the object to respond with the rendered maps in it ordered by ordered,
+// other objects are returned as they are
+func (model *Model) orderedJSON(obj interface{}) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		return model.ordered(v)
+	case []map[string]interface{}:
+		slice := make([]orderedMap, 0, len(v))
+		for _, m := range v {
+			slice = append(slice, model.ordered(m))
+		}
+		return slice
+	}
+	return obj
+}
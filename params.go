@@ -0,0 +1,112 @@
+package apifaker
+
+import (
+	"encoding/json"
+	"mime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultContentTypes the media types of request body accepted by default
+var defaultContentTypes = []string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"}
+
+// mergePatchMediaType the media type of JSON Merge Patch(RFC 7386) request body of PATCH
+const mergePatchMediaType = "application/merge-patch+json"
+
+// mediaType returns the media type of the request without parameters
+func mediaType(ctx *gin.Context) string {
+	mediaType, _, _ := mime.ParseMediaType(ctx.Request.Header.Get("Content-Type"))
+	return mediaType
+}
+
+// jsonBody decodes and returns the json object in the request body,
+// it is cached in the gin.Context for the body can be read only once
+func jsonBody(ctx *gin.Context) (map[string]interface{}, error) {
+	if body, ok := ctx.Get("jsonBody"); ok {
+		return body.(map[string]interface{}), nil
+	}
+
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		return nil, ParamsErrorf("wrong json body: %v", err)
+	}
+	ctx.Set("jsonBody", body)
+	return body, nil
+}
+
+// postValue returns the value of the given column in the request body and if it exists,
+// the body is a json object for application/json, otherwise a form,
+// a string value is formatted by the column type, other json values keep their types,
+// a form value of json column is decoded as json, Column.Alias is used if the name is absent,
+// the value is normalized by the column
+func postValue(ctx *gin.Context, column *Column, model *Model) (interface{}, bool, error) {
+	var value interface{}
+	if mediaType := mediaType(ctx); mediaType == "application/json" || mediaType == mergePatchMediaType {
+		body, err := jsonBody(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		name := column.Name
+		if _, ok := body[name]; !ok && column.Alias != "" {
+			name = column.Alias
+		}
+
+		// keep the json value as it is, including null
+		if column.Type == rawJSON.Name() {
+			value, ok := body[name]
+			return value, ok, nil
+		}
+		value = body[name]
+	} else {
+		value = ctx.PostForm(column.Name)
+		if value == "" && column.Alias != "" {
+			value = ctx.PostForm(column.Alias)
+		}
+	}
+
+	if value == nil || value == "" {
+		return nil, false, nil
+	}
+
+	value, err := formatPostValue(column, value, model)
+	return value, err == nil, err
+}
+
+// formatPostValue returns the value in the request body formatted by the column type if it is a string,
+// and normalized by the column
+func formatPostValue(column *Column, value interface{}, model *Model) (interface{}, error) {
+	if valueStr, ok := value.(string); ok {
+		formatVal, err := FormatValue(column.Type, valueStr)
+		if err != nil {
+			return nil, ParamsErrorf("column[name=\"%s\"] has wrong value: %s", column.Name, valueStr)
+		}
+		value = formatVal
+	}
+
+	return column.Normalize(value, model)
+}
+
+// mergePatch returns the target patched by JSON Merge Patch(RFC 7386),
+// a null member of an object patch removes the member of target, other non-object patches replace target
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMap, ok := target.(map[string]interface{})
+	result := map[string]interface{}{}
+	if ok {
+		for key, value := range targetMap {
+			result[key] = value
+		}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = mergePatch(result[key], value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,361 @@
+package apifaker
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/inflection"
+)
+
+// defaultIncludeLimit the max number of included items of every resource without Model.IncludeLimit
+const defaultIncludeLimit = 100
+
+// includeRelated allocates and returns a new LineItem with the related collections of the given resource names,
+// e.g. ["comments", "likes"] of query param "include=comments,likes",
+// the related resource must have a foreign key column like "post_id",
+// every collection has at most IncludeLimit items sorted by id
+func (model *Model) includeRelated(li LineItem, include []string) (LineItem, error) {
+	newLi := NewLineItemWithMap(li.ToMap())
+	if len(include) == 0 {
+		return newLi, nil
+	}
+
+	limit := model.IncludeLimit
+	if limit <= 0 {
+		limit = defaultIncludeLimit
+	}
+
+	foreignKey := fmt.Sprintf("%s_id", inflection.Singular(model.Name))
+	for _, resName := range include {
+		resRouter, ok := model.relatedRouters()[resName]
+		if !ok {
+			return newLi, QueryErrorf("include has unknown resource: %s", resName)
+		}
+		if _, ok := resRouter.Model.Column(foreignKey); !ok {
+			return newLi, QueryErrorf("include resource[name=\"%s\"] has no column %s", resName, foreignKey)
+		}
+
+		resSlice := []interface{}{}
+		for _, resLi := range resRouter.Model.lineItems() {
+			if len(resSlice) >= limit {
+				break
+			}
+			if value, ok := resLi.Get(foreignKey); ok && reflect.DeepEqual(toFloat64(value), li.Id()) {
+				resSlice = append(resSlice, resRouter.Model.Render(resLi))
+			}
+		}
+		newLi.Set(resName, resSlice)
+	}
+
+	return newLi, nil
+}
+
+// selectView returns the LineItems with only id and the columns of the view with the given name,
+// the included collections are kept, the LineItems are returned as they are without a view
+func (model *Model) selectView(lis LineItems, view string, include []string) (LineItems, error) {
+	if view == "" {
+		return lis, nil
+	}
+
+	columns, ok := model.Views[view]
+	if !ok {
+		return nil, QueryErrorf("unknown view: %s", view)
+	}
+
+	return pickKeys(lis, append(append([]string{"id"}, columns...), include...)), nil
+}
+
+// pickKeys returns the new LineItems with only the given keys
+func pickKeys(lis LineItems, keys []string) LineItems {
+	picked := LineItems{}
+	for _, li := range lis {
+		newLi := NewLineItemWithMap(map[string]interface{}{})
+		for _, key := range keys {
+			if value, ok := li.Get(key); ok {
+				newLi.Set(key, value)
+			}
+		}
+		picked = append(picked, newLi)
+	}
+	return picked
+}
+
+// filterByDateRange returns the LineItems whose date or datetime columns are in the range
+// given by query params "<column>_after" and "<column>_before", both bounds are inclusive,
+// items with a missing or unparseable date are excluded once any bound of its column is given
+func (model *Model) filterByDateRange(lis LineItems, query url.Values) (LineItems, error) {
+	inRange, err := model.dateRangeFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	return lis.Filter(inRange), nil
+}
+
+// dateRangeFilter returns the function reporting if a LineItem is in the date ranges of the query params like filterByDateRange
+func (model *Model) dateRangeFilter(query url.Values) (func(li LineItem) bool, error) {
+	type dateRange struct {
+		column              *Column
+		after, before       time.Time
+		hasAfter, hasBefore bool
+	}
+
+	ranges := []dateRange{}
+	for _, column := range model.Columns {
+		if !column.IsTime() {
+			continue
+		}
+
+		afterStr, beforeStr := query.Get(column.Name+"_after"), query.Get(column.Name+"_before")
+		if afterStr == "" && beforeStr == "" {
+			continue
+		}
+
+		r := dateRange{column: column, hasAfter: afterStr != "", hasBefore: beforeStr != ""}
+		var ok bool
+		if r.hasAfter {
+			if r.after, ok = column.ParseTime(afterStr); !ok {
+				return nil, QueryErrorf("%s_after has wrong format, value: %s, format: %s", column.Name, afterStr, column.TimeLayout())
+			}
+		}
+		if r.hasBefore {
+			if r.before, ok = column.ParseTime(beforeStr); !ok {
+				return nil, QueryErrorf("%s_before has wrong format, value: %s, format: %s", column.Name, beforeStr, column.TimeLayout())
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	return func(li LineItem) bool {
+		for _, r := range ranges {
+			value, _ := li.Get(r.column.Name)
+			t, ok := r.column.ParseTime(value)
+			if !ok || (r.hasAfter && t.Before(r.after)) || (r.hasBefore && t.After(r.before)) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// columnFilters returns the values of the query params named by the columns, e.g. {"status": "paid"} of "status=paid"
+func (model *Model) columnFilters(query url.Values) map[string]string {
+	filters := map[string]string{}
+	for _, column := range model.Columns {
+		if _, ok := query[column.Name]; ok {
+			filters[column.Name] = query.Get(column.Name)
+		}
+	}
+	return filters
+}
+
+// filterByColumns returns the LineItems whose values equal to the filters using the column names as keys,
+// values are compared in their string forms
+func (model *Model) filterByColumns(lis LineItems, filters map[string]string) LineItems {
+	return lis.Filter(func(li LineItem) bool { return matchColumns(li, filters) })
+}
+
+// matchColumns returns if the values of the LineItem equal to the filters like filterByColumns
+func matchColumns(li LineItem, filters map[string]string) bool {
+	for name, expected := range filters {
+		if value, ok := li.Get(name); !ok || fmt.Sprint(value) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCursor returns the opaque cursor for the LineItem with the given id
+func encodeCursor(id float64) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.FormatFloat(id, 'f', -1, 64)))
+}
+
+// decodeCursor returns the id encoded in the cursor
+func decodeCursor(cursor string) (float64, error) {
+	bytes, err := base64.URLEncoding.DecodeString(cursor)
+	if err == nil {
+		var id float64
+		if id, err = strconv.ParseFloat(string(bytes), 64); err == nil {
+			return id, nil
+		}
+	}
+	return 0, QueryErrorf("wrong cursor: %s", cursor)
+}
+
+// Page is a page of the LineItems sorted by id
+type Page struct {
+	LineItems LineItems
+
+	// Offset the index of the first item of the page in all items
+	Offset int
+
+	// Limit the max count of items, 0 means no limit
+	Limit int
+
+	// Total the count of all items
+	Total int
+
+	// NextCursor the cursor of the last item if there are more items
+	NextCursor string
+
+	// Truncated signs if the default limit cut the items
+	Truncated bool
+
+	// Clamped signs if the limit is clamped down to the max limit
+	Clamped bool
+}
+
+// IsPartial returns if the page may not contain all items, i.e. limit or offset is used
+func (page Page) IsPartial() bool {
+	return page.Limit > 0 || page.Offset > 0
+}
+
+// ContentRange returns the value of Content-Range header of the page with the given unit,
+// e.g. "users 0-9/100", or "users */100" for an empty page
+func (page Page) ContentRange(unit string) string {
+	if page.LineItems.Len() == 0 {
+		return fmt.Sprintf("%s */%d", unit, page.Total)
+	}
+	return fmt.Sprintf("%s %d-%d/%d", unit, page.Offset, page.Offset+page.LineItems.Len()-1, page.Total)
+}
+
+// Links returns the value of Link header of the page with rel first, prev, next and last,
+// they are the given url with query params "limit" and "offset", "" if the page has no limit
+func (page Page) Links(u *url.URL) string {
+	if page.Limit <= 0 {
+		return ""
+	}
+
+	link := func(offset int, rel string) string {
+		query := u.Query()
+		query.Del("after")
+		query.Set("limit", strconv.Itoa(page.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, query.Encode(), rel)
+	}
+
+	last := 0
+	if page.Total > 0 {
+		last = (page.Total - 1) / page.Limit * page.Limit
+	}
+	links := []string{link(0, "first")}
+	if page.Offset > 0 {
+		prev := page.Offset - page.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if page.Offset+page.LineItems.Len() < page.Total {
+		links = append(links, link(page.Offset+page.Limit, "next"))
+	}
+	links = append(links, link(last, "last"))
+	return strings.Join(links, ", ")
+}
+
+// paginate slices the LineItems sorted by id with Limit, Offset and After of the Query,
+// defaultLimit is used if Limit is absent and All is false,
+// a limit bigger than maxLimit, or no limit, is clamped down to maxLimit if it is positive
+func (query Query) paginate(lis LineItems, defaultLimit, maxLimit int) (page Page) {
+	page.Total = lis.Len()
+	page.Limit = query.Limit
+	if page.Limit == absentLimit {
+		page.Limit = 0
+		if !query.All {
+			page.Limit = defaultLimit
+		}
+	}
+	if maxLimit > 0 && (page.Limit == 0 || page.Limit > maxLimit) {
+		page.Limit = maxLimit
+		page.Clamped = true
+	}
+
+	page.Offset = query.Offset
+	if query.After != "" {
+		afterId, _ := decodeCursor(query.After)
+		for page.Offset < lis.Len() && lis[page.Offset].ID() <= afterId {
+			page.Offset++
+		}
+	}
+
+	if page.Offset > lis.Len() {
+		page.Offset = lis.Len()
+	}
+	page.LineItems = lis[page.Offset:]
+	if page.Limit > 0 && page.Limit < page.LineItems.Len() {
+		page.LineItems = page.LineItems[:page.Limit]
+		page.NextCursor = encodeCursor(page.LineItems[page.Limit-1].ID())
+		page.Truncated = query.Limit == absentLimit
+	}
+
+	return page
+}
+
+// randomSample returns at most n random LineItems chosen without replacement,
+// n is given by query param "n" and defaults to 1,
+// items are weighted by the number column given by query param "weight" if it is present,
+// the ones with a missing or non-positive weight are never chosen
+func (model *Model) randomSample(lis LineItems, query url.Values, r *rand.Rand) (LineItems, error) {
+	n := 1
+	if nStr := query.Get("n"); nStr != "" {
+		var err error
+		if n, err = strconv.Atoi(nStr); err != nil || n < 0 {
+			return nil, QueryErrorf("n must be a non-negative integer, value: %s", nStr)
+		}
+	}
+
+	weights := make([]float64, len(lis))
+	weightName := query.Get("weight")
+	if weightName != "" {
+		if column, ok := model.Column(weightName); !ok || column.Type != number.Name() {
+			return nil, QueryErrorf("weight must be a number column, value: %s", weightName)
+		}
+	}
+	for i, li := range lis {
+		weights[i] = 1
+		if weightName != "" {
+			weights[i], _ = li.dataMap[weightName].(float64)
+		}
+	}
+
+	candidates := append(LineItems{}, lis...)
+	sample := LineItems{}
+	for len(sample) < n {
+		total := float64(0)
+		for _, weight := range weights {
+			if weight > 0 {
+				total += weight
+			}
+		}
+		if total <= 0 {
+			break
+		}
+
+		target := r.Float64() * total
+		i := 0
+		for ; i < len(weights)-1; i++ {
+			if weights[i] <= 0 {
+				continue
+			}
+			if target < weights[i] {
+				break
+			}
+			target -= weights[i]
+		}
+		// the last index may be reached by rounding errors with a non-positive weight
+		for weights[i] <= 0 {
+			i--
+		}
+
+		sample = append(sample, candidates[i])
+		candidates = append(candidates[:i], candidates[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+
+	return sample, nil
+}
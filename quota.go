@@ -0,0 +1,94 @@
+package apifaker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota is a fixed number of requests allowed for every client in every window, e.g. 100 per day,
+// the requests over it get 429 until the window of the client resets
+type Quota struct {
+	// Limit the number of requests in a window, 0 means no quota
+	Limit int
+
+	// Window the period after which the count of a client resets, it starts at the first request
+	Window time.Duration
+
+	// KeyHeader the request header of the API key identifying a client, e.g. "X-Api-Key",
+	// the requests without it are identified by the client IP, empty means IP only
+	KeyHeader string
+}
+
+// quotaCounter counts the requests of a client in the current window
+type quotaCounter struct {
+	count   int
+	resetAt time.Time
+}
+
+// SetQuota sets the request quota of every client and resets all counts,
+// a Quota with a non-positive Limit or Window turns it off
+func (af *ApiFaker) SetQuota(quota Quota) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.quota = quota
+	af.quotaCounters = map[string]*quotaCounter{}
+}
+
+// quotaKey returns the key of the client of the request
+func (af *ApiFaker) quotaKey(ctx *gin.Context, quota Quota) string {
+	if quota.KeyHeader != "" {
+		if key := ctx.Request.Header.Get(quota.KeyHeader); key != "" {
+			return "key:" + key
+		}
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// useQuota counts the request and returns the quota, the remaining count and the reset time of its client,
+// ok is false if the client has used up its quota, enabled is false if there is no quota
+func (af *ApiFaker) useQuota(ctx *gin.Context) (quota Quota, remaining int, resetAt time.Time, ok, enabled bool) {
+	af.Lock()
+	defer af.Unlock()
+
+	quota = af.quota
+	if quota.Limit <= 0 || quota.Window <= 0 {
+		return quota, 0, resetAt, true, false
+	}
+
+	now := time.Now()
+	key := af.quotaKey(ctx, quota)
+	counter, found := af.quotaCounters[key]
+	if !found || !now.Before(counter.resetAt) {
+		counter = &quotaCounter{resetAt: now.Add(quota.Window)}
+		af.quotaCounters[key] = counter
+	}
+
+	if counter.count >= quota.Limit {
+		return quota, 0, counter.resetAt, false, true
+	}
+	counter.count++
+	return quota, quota.Limit - counter.count, counter.resetAt, true, true
+}
+
+// checkQuota sets the X-RateLimit headers and responds 429 if the client has used up its quota
+func (af *ApiFaker) checkQuota(ctx *gin.Context) {
+	quota, remaining, resetAt, ok, enabled := af.useQuota(ctx)
+	if !enabled {
+		return
+	}
+
+	ctx.Header("X-RateLimit-Limit", strconv.Itoa(quota.Limit))
+	ctx.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	ctx.Header("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+	if !ok {
+		retryAfter := int(time.Until(resetAt).Seconds() + 1)
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		af.respondError(ctx, http.StatusTooManyRequests, fmt.Errorf("quota of %d requests is exceeded", quota.Limit))
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,93 @@
+package apifaker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRecordSize the default max number of recorded requests
+const defaultRecordSize = 100
+
+// RecordedRequest is an incoming request recorded in recording mode
+type RecordedRequest struct {
+	RequestID string      `json:"request_id"`
+	Time      time.Time   `json:"time"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Query     string      `json:"query"`
+	Headers   http.Header `json:"headers"`
+	Body      string      `json:"body"`
+}
+
+// SetRecording turns on or turns off the recording mode, in which every request of fake apis is recorded
+// in a ring buffer of size, the oldest one is dropped when it is full, the recorded requests are kept after turning off
+func (af *ApiFaker) SetRecording(on bool, size int) {
+	af.Lock()
+	defer af.Unlock()
+
+	if size <= 0 {
+		size = defaultRecordSize
+	}
+	af.recording = on
+	af.recordSize = size
+	if len(af.records) > size {
+		af.records = af.records[len(af.records)-size:]
+	}
+}
+
+// IsRecording returns if ApiFaker is in recording mode
+func (af *ApiFaker) IsRecording() bool {
+	af.RLock()
+	defer af.RUnlock()
+	return af.recording
+}
+
+// RecordedRequests returns the recorded requests from the oldest one
+func (af *ApiFaker) RecordedRequests() []RecordedRequest {
+	af.RLock()
+	defer af.RUnlock()
+	return append([]RecordedRequest{}, af.records...)
+}
+
+// ClearRecordedRequests removes all recorded requests
+func (af *ApiFaker) ClearRecordedRequests() {
+	af.Lock()
+	defer af.Unlock()
+	af.records = nil
+}
+
+// record records the request of ctx in recording mode, the body is restored for handlers
+func (af *ApiFaker) record(ctx *gin.Context) {
+	if !af.IsRecording() {
+		return
+	}
+
+	body := []byte{}
+	if ctx.Request.Body != nil {
+		body, _ = ioutil.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	requestID, _ := ctx.Get("requestID")
+	requestIDStr, _ := requestID.(string)
+	record := RecordedRequest{
+		RequestID: requestIDStr,
+		Time:      time.Now(),
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Query:     ctx.Request.URL.RawQuery,
+		Headers:   ctx.Request.Header.Clone(),
+		Body:      string(body),
+	}
+
+	af.Lock()
+	defer af.Unlock()
+
+	af.records = append(af.records, record)
+	if len(af.records) > af.recordSize {
+		af.records = af.records[len(af.records)-af.recordSize:]
+	}
+}
@@ -0,0 +1,120 @@
+package apifaker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response is a canned response with a status code and a json body
+type Response struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body"`
+}
+
+// ModelHandlerFunc handles a request of a model, it can use the model by Add, Get, Update, etc.
+type ModelHandlerFunc func(ctx *gin.Context, model *Model)
+
+// OverrideHandler makes the given handler handle the routes of the resource with the given method
+// instead of the generated ones, e.g. "GET" overrides both GET /collection and GET /collection/:id,
+// which can be told by ctx.Param("id"), the id is still checked before the handler,
+// the model of the tenant or seed profile of the request is given,
+// a nil handler restores the generated ones, it returns an error for an unknown resource or method
+func (af *ApiFaker) OverrideHandler(resourceName, method string, handler ModelHandlerFunc) error {
+	router, ok := af.routers()[resourceName]
+	if !ok {
+		return fmt.Errorf("unknown resource: %s", resourceName)
+	}
+
+	found := false
+	for _, route := range router.Routes {
+		found = found || route.Method.String() == method
+	}
+	if !found {
+		return fmt.Errorf("resource %s has no routes of method %s", resourceName, method)
+	}
+
+	af.Lock()
+	defer af.Unlock()
+
+	if af.overrides == nil {
+		af.overrides = map[string]ModelHandlerFunc{}
+	}
+	if handler == nil {
+		delete(af.overrides, resourceName+" "+method)
+	} else {
+		af.overrides[resourceName+" "+method] = handler
+	}
+	return nil
+}
+
+// overrideHandler returns the handler overriding the routes of the resource with the method and if it exists
+func (af *ApiFaker) overrideHandler(resourceName, method string) (ModelHandlerFunc, bool) {
+	af.RLock()
+	defer af.RUnlock()
+
+	handler, ok := af.overrides[resourceName+" "+method]
+	return handler, ok
+}
+
+// ForceResponse makes every request with the given method and path get the given response,
+// path is the whole request path including the Prefix, e.g. "/users/1"
+func (af *ApiFaker) ForceResponse(method, path string, response Response) {
+	af.Lock()
+	defer af.Unlock()
+
+	if af.forcedResponses == nil {
+		af.forcedResponses = map[string]Response{}
+	}
+	af.forcedResponses[method+" "+path] = response
+}
+
+// ClearForcedResponse stops forcing the response for the given method and path
+func (af *ApiFaker) ClearForcedResponse(method, path string) {
+	af.Lock()
+	defer af.Unlock()
+
+	delete(af.forcedResponses, method+" "+path)
+}
+
+// forcedResponse returns the response forced for the given method and path and if it exists
+func (af *ApiFaker) forcedResponse(method, path string) (Response, bool) {
+	af.RLock()
+	defer af.RUnlock()
+
+	response, ok := af.forcedResponses[method+" "+path]
+	return response, ok
+}
+
+// mockErrorHeader the request header forcing the request to get the error status in it, e.g. "X-Mock-Error: 500"
+const mockErrorHeader = "X-Mock-Error"
+
+// SetMockErrorHeader enables or disables the X-Mock-Error header, it is disabled by default,
+// a request with the header gets the status in it with a generic error body if it is enabled
+func (af *ApiFaker) SetMockErrorHeader(enabled bool) {
+	af.Lock()
+	defer af.Unlock()
+
+	af.mockErrorHeader = enabled
+}
+
+// mockError returns the status code in the X-Mock-Error header of the request and if the request has the header,
+// the error is not nil if the header is not a status code of 400-599
+func (af *ApiFaker) mockError(ctx *gin.Context) (int, bool, error) {
+	af.RLock()
+	enabled := af.mockErrorHeader
+	af.RUnlock()
+
+	header := ctx.Request.Header.Get(mockErrorHeader)
+	if !enabled || header == "" {
+		return 0, false, nil
+	}
+
+	status, err := strconv.Atoi(header)
+	if err != nil || status < http.StatusBadRequest || status > 599 {
+		return 0, true, fmt.Errorf("%s must be a status code of 400-599, value: %s", mockErrorHeader, header)
+	}
+	return status, true, nil
+}
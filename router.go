@@ -14,12 +14,54 @@ const (
 	DELETE
 )
 
+// String returns the name of the method, e.g. "GET"
+func (method RestMethod) String() string {
+	switch method {
+	case GET:
+		return "GET"
+	case POST:
+		return "POST"
+	case PUT:
+		return "PUT"
+	case PATCH:
+		return "PATCH"
+	case DELETE:
+		return "DELETE"
+	}
+	return ""
+}
+
+// actions of restful routes, they are used in the "actions" of a model json file
+const (
+	IndexAction  = "index"
+	ShowAction   = "show"
+	CreateAction = "create"
+	UpdateAction = "update"
+	DeleteAction = "delete"
+)
+
+// extraActions maps the actions of the routes besides the restful ones to the actions they are allowed with
+var extraActions = map[string]string{
+	blobAction:    ShowAction,
+	csvAction:     IndexAction,
+	replaceAction: UpdateAction,
+}
+
+// randomId the id param of GET /collection/random
+const randomId = "random"
+
+// allActions contains all the actions in order
+var allActions = []string{IndexAction, ShowAction, CreateAction, UpdateAction, DeleteAction}
+
 type Route struct {
 	// Method request method only supports GET, POST, PUT, PATCH, DELETE
 	Method RestMethod
 
 	// Path
 	Path string
+
+	// Action one of index, show, create, update and delete
+	Action string
 }
 
 type Router struct {
@@ -28,32 +70,67 @@ type Router struct {
 
 	apiFaker *ApiFaker
 	filePath string
+
+	// combined the file of the Model has other models too, so it is only read
+	combined bool
 }
 
 func (r *Router) setRestRoutes() {
+	if r.Model.Singleton {
+		r.Routes = []Route{
+			// GET /resource
+			{GET, fmt.Sprintf("/%s", r.Model.RouteName()), ShowAction},
+
+			// PUT /resource
+			{PUT, fmt.Sprintf("/%s", r.Model.RouteName()), UpdateAction},
+		}
+		for _, column := range r.Model.blobColumns() {
+			// GET /resource/<blob column>
+			r.Routes = append(r.Routes, Route{GET, fmt.Sprintf("/%s/%s", r.Model.RouteName(), column.Name), blobAction})
+		}
+		return
+	}
+
 	r.Routes = []Route{
 		// GET /collection
-		{GET, fmt.Sprintf("/%s", r.Model.Name)},
+		{GET, fmt.Sprintf("/%s", r.Model.RouteName()), IndexAction},
 
 		// GET /collection/:id
-		{GET, fmt.Sprintf("/%s/:id", r.Model.Name)},
+		{GET, fmt.Sprintf("/%s/:id", r.Model.RouteName()), ShowAction},
 
 		// POST /collection
-		{POST, fmt.Sprintf("/%s", r.Model.Name)},
+		{POST, fmt.Sprintf("/%s", r.Model.RouteName()), CreateAction},
 
-		// PUT /collection
-		{PUT, fmt.Sprintf("/%s/:id", r.Model.Name)},
+		// PUT /collection/:id
+		{PUT, fmt.Sprintf("/%s/:id", r.Model.RouteName()), UpdateAction},
+
+		// PATCH /collection/:id
+		{PATCH, fmt.Sprintf("/%s/:id", r.Model.RouteName()), UpdateAction},
 
-		// PATCH /collection
-		{PATCH, fmt.Sprintf("/%s/:id", r.Model.Name)},
+		// DELETE /collection/:id
+		{DELETE, fmt.Sprintf("/%s/:id", r.Model.RouteName()), DeleteAction},
 
-		// DELETE /collection
-		{DELETE, fmt.Sprintf("/%s/:id", r.Model.Name)},
+		// PUT /collection
+		{PUT, fmt.Sprintf("/%s", r.Model.RouteName()), replaceAction},
+
+		// GET /collection.csv
+		{GET, fmt.Sprintf("/%s.csv", r.Model.RouteName()), csvAction},
+	}
+	for _, column := range r.Model.blobColumns() {
+		// GET /collection/:id/<blob column>
+		r.Routes = append(r.Routes, Route{GET, fmt.Sprintf("/%s/:id/%s", r.Model.RouteName(), column.Name), blobAction})
 	}
 }
 
-// SaveToFile
+// SaveToFile saves the Model to its json file,
+// it returns an error for the Model added by ApiFaker.AddModel or in a combined file
 func (r *Router) SaveToFile() error {
+	if r.filePath == "" {
+		return JsonFileErrorf("model[name=\"%s\"] has no json file", r.Model.Name)
+	}
+	if r.combined {
+		return JsonFileErrorf("model[name=\"%s\"] in the combined file can not be saved to file: %s", r.Model.Name, r.filePath)
+	}
 	return r.Model.SaveToFile(r.filePath)
 }
 
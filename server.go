@@ -0,0 +1,95 @@
+package apifaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout the default time to drain the in-flight requests in Run
+const defaultShutdownTimeout = 10 * time.Second
+
+// Start listens on the given address and serves in a new goroutine, call Shutdown to stop,
+// the address could use port 0 to choose a free port, see Addr for the chosen one
+func (af *ApiFaker) Start(addr string) error {
+	af.Lock()
+	defer af.Unlock()
+
+	if af.server != nil {
+		return fmt.Errorf("apifaker has been started at %s", af.listener.Addr())
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: af}
+	af.server = server
+	af.listener = listener
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println(err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address listened by Start, it is empty before Start
+func (af *ApiFaker) Addr() string {
+	af.RLock()
+	defer af.RUnlock()
+
+	if af.listener == nil {
+		return ""
+	}
+	return af.listener.Addr().String()
+}
+
+// Shutdown stops accepting new connections and waits for the in-flight requests until ctx is done,
+// then saves all models into json files if save is true, it could Start again after Shutdown
+func (af *ApiFaker) Shutdown(ctx context.Context, save bool) error {
+	af.Lock()
+	server := af.server
+	af.server = nil
+	af.listener = nil
+	af.Unlock()
+
+	if server == nil {
+		return fmt.Errorf("apifaker has not been started")
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if save {
+		af.SaveToFile()
+	}
+	return nil
+}
+
+// Run starts at the given address and shuts down when the process receives SIGINT or SIGTERM,
+// the in-flight requests are drained in timeout(default 10s), models are saved into json files if save is true
+func (af *ApiFaker) Run(addr string, timeout time.Duration, save bool) error {
+	if err := af.Start(addr); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	<-signals
+
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return af.Shutdown(ctx, save)
+}
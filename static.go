@@ -0,0 +1,232 @@
+package apifaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticRoutesFileName the json file in ApiDir declaring the static routes instead of a resource
+const staticRoutesFileName = "static_routes.json"
+
+// StaticRoute is a fixed json response at a path which is not a resource, e.g. GET /config
+type StaticRoute struct {
+	// Method the request method, default GET
+	Method string `json:"method"`
+
+	// Path the path under Prefix, e.g. "/config", a path ending with "/*" is a catch-all of the paths under it,
+	// e.g. "/legacy/*" matches "/legacy" and "/legacy/a/b", it only handles the requests no other route matches
+	Path string `json:"path"`
+
+	// Response the status(default 200) and the body
+	Response
+
+	// Alias responds the items of a resource instead of the body, only for GET
+	Alias *RouteAlias `json:"alias,omitempty"`
+}
+
+// RouteAlias serves the items of a resource matching the filter at a static route, e.g. GET /me for a user
+type RouteAlias struct {
+	// Resource the resource name of the items
+	Resource string `json:"resource"`
+
+	// Filter the values of columns the items must have, e.g. {"id": 1}
+	Filter map[string]interface{} `json:"filter,omitempty"`
+
+	// FilterHeaders the request headers whose values the columns must have, e.g. {"id": "X-User-Id"}
+	FilterHeaders map[string]string `json:"filter_headers,omitempty"`
+
+	// One responds the first matching item instead of an array, or 404 if no item matches
+	One bool `json:"one,omitempty"`
+}
+
+// loadStaticRoutes reads the static routes from the json file of the given path
+func (af *ApiFaker) loadStaticRoutes(path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	routes := []StaticRoute{}
+	if err := json.Unmarshal(bytes, &routes); err != nil {
+		return JsonFileErrorf("%s has wrong static routes: %v", path, err)
+	}
+	for i := range routes {
+		if routes[i].Method == "" {
+			routes[i].Method = "GET"
+		}
+		if routes[i].Status == 0 {
+			routes[i].Status = http.StatusOK
+		}
+	}
+	af.staticRoutes = routes
+	return nil
+}
+
+// CheckStaticRoutes checks if every static route has a known method and a different path starting with "/",
+// which is neither under a resource nor the admin apis
+func (af *ApiFaker) CheckStaticRoutes() error {
+	used := map[string]bool{}
+	for _, route := range af.staticRoutes {
+		switch route.Method {
+		case "GET", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return JsonFileErrorf("static route %s has unsupported method: %s", route.Path, route.Method)
+		}
+
+		if !strings.HasPrefix(route.Path, "/") {
+			return JsonFileErrorf("static route path must start with \"/\": %s", route.Path)
+		}
+		if strings.Contains(strings.TrimSuffix(route.Path, "/*"), "*") {
+			return JsonFileErrorf("static route path can only end with \"/*\" as a wildcard: %s", route.Path)
+		}
+		firstPiece := strings.Split(strings.TrimPrefix(route.Path, "/"), "/")[0]
+		if _, ok := af.routerByRouteName(firstPiece); ok || firstPiece == "admin" {
+			return JsonFileErrorf("static route %s conflicts with the routes of %s", route.Path, firstPiece)
+		}
+
+		if err := af.checkRouteAlias(route); err != nil {
+			return err
+		}
+
+		key := route.Method + " " + route.Path
+		if used[key] {
+			return JsonFileErrorf("static route %s has been declared", key)
+		}
+		used[key] = true
+	}
+	return nil
+}
+
+// checkRouteAlias checks if the alias of the static route is a GET of a known resource filtered by its columns
+func (af *ApiFaker) checkRouteAlias(route StaticRoute) error {
+	alias := route.Alias
+	if alias == nil {
+		return nil
+	}
+	if route.Method != "GET" {
+		return JsonFileErrorf("static route %s with alias must be GET", route.Path)
+	}
+
+	router, ok := af.Routers[alias.Resource]
+	if !ok {
+		return JsonFileErrorf("static route %s has unknown alias resource: %s", route.Path, alias.Resource)
+	}
+	names := []string{}
+	for name := range alias.Filter {
+		names = append(names, name)
+	}
+	for name := range alias.FilterHeaders {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := router.Model.Column(name); !ok {
+			return JsonFileErrorf("static route %s filters unknown column %s of %s", route.Path, name, alias.Resource)
+		}
+	}
+	return nil
+}
+
+// setStaticHandlers sets the handlers of the static routes
+func (af *ApiFaker) setStaticHandlers(engine *gin.Engine) {
+	catchAlls := []StaticRoute{}
+	for _, route := range af.staticRoutes {
+		route := route
+		if route.IsCatchAll() {
+			catchAlls = append(catchAlls, route)
+			continue
+		}
+		engine.Handle(route.Method, af.Prefix+route.Path, func(ctx *gin.Context) {
+			af.respondStatic(ctx, route)
+		})
+	}
+	if len(catchAlls) == 0 {
+		return
+	}
+
+	// the longest path is matched first
+	sort.SliceStable(catchAlls, func(i, j int) bool {
+		return len(catchAlls[i].Path) > len(catchAlls[j].Path)
+	})
+	engine.NoRoute(func(ctx *gin.Context) {
+		if !strings.HasPrefix(ctx.Request.URL.Path, af.Prefix) {
+			return
+		}
+		path := strings.TrimPrefix(ctx.Request.URL.Path, af.Prefix)
+		for _, route := range catchAlls {
+			if route.Method == ctx.Request.Method && route.matches(path) {
+				af.respondStatic(ctx, route)
+				return
+			}
+		}
+	})
+}
+
+// IsCatchAll returns if the path of the static route ends with "/*"
+func (route StaticRoute) IsCatchAll() bool {
+	return strings.HasSuffix(route.Path, "/*")
+}
+
+// matches returns if the path under Prefix is matched by the catch-all static route
+func (route StaticRoute) matches(path string) bool {
+	base := strings.TrimSuffix(route.Path, "/*")
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+// respondStatic responds the body or the items of the alias of the static route
+func (af *ApiFaker) respondStatic(ctx *gin.Context, route StaticRoute) {
+	if route.Alias != nil {
+		af.respondAlias(ctx, route)
+		return
+	}
+	af.respond(ctx, route.Status, route.Body)
+}
+
+// respondAlias responds the visible items of the alias resource matching the filter,
+// values are compared in their string forms, a filter header absent in the request matches nothing
+func (af *ApiFaker) respondAlias(ctx *gin.Context, route StaticRoute) {
+	alias := route.Alias
+	scoped, err := af.scoped(ctx)
+	if err != nil {
+		af.respondError(ctx, ErrorStatus(err), err)
+		return
+	}
+	model := scoped.routers()[alias.Resource].Model
+
+	filter := map[string]string{}
+	for name, value := range alias.Filter {
+		filter[name] = fmt.Sprint(value)
+	}
+	missing := false
+	for name, header := range alias.FilterHeaders {
+		filter[name] = ctx.Request.Header.Get(header)
+		missing = missing || filter[name] == ""
+	}
+
+	lis := model.visibleLineItems().Filter(func(li LineItem) bool {
+		if missing {
+			return false
+		}
+		for name, expected := range filter {
+			if value, ok := li.Get(name); !ok || fmt.Sprint(value) != expected {
+				return false
+			}
+		}
+		return true
+	})
+
+	if !alias.One {
+		af.respond(ctx, route.Status, model.orderedJSON(model.RenderSlice(lis)))
+		return
+	}
+	if len(lis) == 0 {
+		af.respondError(ctx, http.StatusNotFound, nil)
+		return
+	}
+	af.respond(ctx, route.Status, model.orderedJSON(model.Render(lis[0])))
+}
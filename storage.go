@@ -0,0 +1,114 @@
+package apifaker
+
+import (
+	"github.com/Focinfi/gset"
+)
+
+// Storage stores the LineItems of a Model using their ids as the keys,
+// the default one keeps them in memory, the one of NewFileStorage reads them lazily from a file,
+// other ones like a database could be set by Model.SetStorage
+type Storage interface {
+	// Get returns the LineItem with the given id and if it exists
+	Get(id float64) (LineItem, bool)
+
+	// Add adds the LineItem or replaces the one with the same id
+	Add(li LineItem) error
+
+	// Remove removes the LineItem with the given id
+	Remove(id float64) error
+
+	// Has returns if the LineItem with the given id exists
+	Has(id float64) bool
+
+	// Len returns the count of LineItems
+	Len() int
+
+	// Iterate calls f with every LineItem in any order until f returns false
+	Iterate(f func(li LineItem) bool)
+}
+
+// memoryStorage is the Storage in memory
+type memoryStorage struct {
+	set *gset.SetThreadSafe
+}
+
+// NewMemoryStorage allocates and returns a new empty Storage in memory, it is the default Storage of Model
+func NewMemoryStorage() Storage {
+	return &memoryStorage{set: gset.NewSetThreadSafe()}
+}
+
+// Get implements Storage
+func (storage *memoryStorage) Get(id float64) (LineItem, bool) {
+	element, ok := storage.set.Get(id)
+	if !ok {
+		return LineItem{}, false
+	}
+	li, ok := element.(LineItem)
+	return li, ok
+}
+
+// Add implements Storage
+func (storage *memoryStorage) Add(li LineItem) error {
+	storage.set.Add(li)
+	return nil
+}
+
+// Remove implements Storage
+func (storage *memoryStorage) Remove(id float64) error {
+	storage.set.Remove(gset.T(id))
+	return nil
+}
+
+// Has implements Storage
+func (storage *memoryStorage) Has(id float64) bool {
+	return storage.set.Has(gset.T(id))
+}
+
+// Len implements Storage
+func (storage *memoryStorage) Len() int {
+	return storage.set.Len()
+}
+
+// Iterate implements Storage
+func (storage *memoryStorage) Iterate(f func(li LineItem) bool) {
+	for _, element := range storage.set.ToSlice() {
+		if li, ok := element.(LineItem); ok && !f(li) {
+			return
+		}
+	}
+}
+
+// SetStorage replaces the Storage of the Model, the data in memory is copied into an empty storage,
+// a storage with data like a durable database keeps its data, the Storage is not replaced if the copying fails
+func (model *Model) SetStorage(storage Storage) error {
+	model.Lock()
+	defer model.Unlock()
+
+	if storage.Len() == 0 {
+		for _, li := range model.lineItems() {
+			if err := storage.Add(li); err != nil {
+				return err
+			}
+		}
+	}
+	model.Set = storage
+	model.currentId = 0
+	for _, column := range model.Columns {
+		column.uniqueValues = nil
+	}
+	for _, li := range model.lineItems() {
+		model.addUniqueValues(li)
+		model.updateId(li.ID())
+	}
+	return nil
+}
+
+// clearStorage removes all LineItems from the Storage
+func (model *Model) clearStorage() error {
+	for _, li := range model.lineItems() {
+		if err := model.Set.Remove(li.ID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
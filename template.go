@@ -0,0 +1,89 @@
+package apifaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateFuncs the functions can be used in response templates,
+// e.g. {"data": {{json .Items}}, "page": {{json .Params.page}}}
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		bytes, err := json.Marshal(v)
+		return string(bytes), err
+	},
+}
+
+// templateData is the data of response templates
+type templateData struct {
+	// Item the responded item of show, create and update
+	Item map[string]interface{}
+
+	// Items the responded items of index
+	Items []map[string]interface{}
+
+	// Params the query params and the id param
+	Params map[string]string
+}
+
+// template returns the parsed template of the given action and if it exists
+func (model *Model) template(action string) (*template.Template, bool, error) {
+	text, ok := model.Templates[action]
+	if !ok {
+		return nil, false, nil
+	}
+
+	tmpl, err := template.New(model.Name + "." + action).Funcs(templateFuncs).Parse(text)
+	return tmpl, true, err
+}
+
+// CheckTemplatesMeta checks if every template is for a known action and can be parsed
+func (model *Model) CheckTemplatesMeta() error {
+	for action := range model.Templates {
+		if action == DeleteAction || !model.knowsAction(action) {
+			return JsonFileErrorf("templates has unsupported action \"%s\" in model[name=\"%s\"]", action, model.Name)
+		}
+		if _, _, err := model.template(action); err != nil {
+			return JsonFileErrorf("templates has wrong template of action \"%s\" in model[name=\"%s\"], error: %v", action, model.Name, err)
+		}
+	}
+	return nil
+}
+
+// respondAction responds obj as json like respond with the keys of items in the order of the columns,
+// or the output of the template of the action if model has one
+func (af *ApiFaker) respondAction(ctx *gin.Context, model *Model, action string, code int, obj interface{}) {
+	tmpl, ok, err := model.template(action)
+	if !ok || !bodyAllowedForStatus(code) {
+		af.respond(ctx, code, model.orderedJSON(obj))
+		return
+	}
+
+	data := templateData{Params: map[string]string{}}
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		data.Item = v
+	case []map[string]interface{}:
+		data.Items = v
+	}
+	for key := range ctx.Request.URL.Query() {
+		data.Params[key] = ctx.Query(key)
+	}
+	if id := ctx.Param("id"); id != "" {
+		data.Params["id"] = id
+	}
+
+	buf := &bytes.Buffer{}
+	if err == nil {
+		err = tmpl.Execute(buf, data)
+	}
+	if err != nil {
+		af.respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.Data(code, "application/json; charset=utf-8", buf.Bytes())
+}
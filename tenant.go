@@ -0,0 +1,115 @@
+package apifaker
+
+import (
+	"github.com/Focinfi/gtester"
+	"github.com/gin-gonic/gin"
+)
+
+// tenantName returns the tenant of the request and if it exists,
+// it is the string set by the before hook with ctx.Set("tenant", ...) or the value of TenantHeader
+func (af *ApiFaker) tenantName(ctx *gin.Context) (string, bool) {
+	if tenant, ok := ctx.Get("tenant"); ok {
+		if name, ok := tenant.(string); ok && name != "" {
+			return name, true
+		}
+	}
+
+	if af.TenantHeader == "" {
+		return "", false
+	}
+	name := ctx.Request.Header.Get(af.TenantHeader)
+	return name, name != ""
+}
+
+// seedProfileHeader the request header to choose a seed profile,
+// the request sees the data initialized from the seeds of the profile
+const seedProfileHeader = "X-Seed-Profile"
+
+// emptySeedProfile the seed profile without data for all models
+const emptySeedProfile = "empty"
+
+// tenantKey is the key of the data of a tenant in a seed profile
+type tenantKey struct {
+	name    string
+	profile string
+}
+
+// scoped returns the ApiFaker holding the data of the tenant and the seed profile of the request,
+// it is af itself for the request without a tenant or a seed profile,
+// data of a new tenant is initialized from Seeds or the seeds of the profile,
+// a QueryError is returned if the data can not be initialized
+func (af *ApiFaker) scoped(ctx *gin.Context) (*ApiFaker, error) {
+	name, _ := af.tenantName(ctx)
+	key := tenantKey{name: name, profile: ctx.Request.Header.Get(seedProfileHeader)}
+	if key.name == "" && key.profile == "" {
+		return af, nil
+	}
+
+	af.Lock()
+	defer af.Unlock()
+
+	if tenant, ok := af.tenants[key]; ok {
+		return tenant, nil
+	}
+
+	tenant, err := af.newTenant(key.profile)
+	if err != nil {
+		return nil, QueryErrorf("data of tenant \"%s\" with seed profile \"%s\" can not be initialized: %v", key.name, key.profile, err)
+	}
+	if af.tenants == nil {
+		af.tenants = map[tenantKey]*ApiFaker{}
+	}
+	af.tenants[key] = tenant
+	return tenant, nil
+}
+
+// newTenant allocates and returns a new ApiFaker with the clones of all models seeded by the given profile,
+// it only holds data and never serves or saves to files
+func (af *ApiFaker) newTenant(profile string) (*ApiFaker, error) {
+	tenant := &ApiFaker{
+		ApiDir:     af.ApiDir,
+		Routers:    map[string]*Router{},
+		transforms: af.transforms,
+	}
+
+	for name, router := range af.Routers {
+		tenantRouter := &Router{apiFaker: tenant, filePath: router.filePath, combined: router.combined, Routes: router.Routes}
+		model, err := router.Model.clone(tenantRouter, profile)
+		if err != nil {
+			return nil, err
+		}
+		tenantRouter.Model = model
+		tenant.Routers[name] = tenantRouter
+	}
+
+	err := gtester.NewCheckQueue().
+		Add(tenant.CheckUniqueness).
+		Add(tenant.CheckRelationships).
+		Run()
+	return tenant, err
+}
+
+// hasSeedProfile returns if the given profile is "empty" or declared by any model
+func (af *ApiFaker) hasSeedProfile(profile string) bool {
+	if profile == emptySeedProfile {
+		return true
+	}
+	for _, router := range af.Routers {
+		if _, ok := router.Model.SeedProfiles[profile]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSeedProfiles checks the seeds of every seed profile
+func (af *ApiFaker) CheckSeedProfiles() error {
+	for _, router := range af.Routers {
+		for profile := range router.Model.SeedProfiles {
+			if _, err := af.newTenant(profile); err != nil {
+				return SeedsErrorf("seed profile \"%s\" has wrong seeds: %v", profile, err)
+			}
+		}
+	}
+	return nil
+}
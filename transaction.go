@@ -0,0 +1,105 @@
+package apifaker
+
+// modelSnapshot is the copy of the runtime data of a Model
+type modelSnapshot struct {
+	items           []map[string]interface{}
+	currentId       float64
+	dataChanged     bool
+	idempotencyKeys map[string]idempotencyRecord
+}
+
+// takeSnapshot returns the copy of the runtime data,
+// every LineItem is copied for soft delete changes it in place
+func (model *Model) takeSnapshot() modelSnapshot {
+	model.RLock()
+	defer model.RUnlock()
+
+	snapshot := modelSnapshot{
+		currentId:       model.currentId,
+		dataChanged:     model.dataChanged,
+		idempotencyKeys: map[string]idempotencyRecord{},
+	}
+	for _, li := range model.lineItems() {
+		snapshot.items = append(snapshot.items, li.ToMap())
+	}
+	for key, record := range model.idempotencyKeys {
+		snapshot.idempotencyKeys[key] = record
+	}
+	return snapshot
+}
+
+// restoreSnapshot replaces the runtime data with the snapshot which should not be used again,
+// the writes in ConsistencyDelay are dropped
+func (model *Model) restoreSnapshot(snapshot modelSnapshot) error {
+	model.Lock()
+	defer model.Unlock()
+
+	for _, column := range model.Columns {
+		column.uniqueValues = nil
+	}
+	if err := model.clearStorage(); err != nil {
+		return err
+	}
+	for _, item := range snapshot.items {
+		li := NewLineItemWithMap(item)
+		if err := model.Set.Add(li); err != nil {
+			return err
+		}
+		model.addUniqueValues(li)
+	}
+	model.currentId = snapshot.currentId
+	model.dataChanged = snapshot.dataChanged
+	model.idempotencyKeys = snapshot.idempotencyKeys
+	model.pendings = nil
+	return nil
+}
+
+// Begin snapshots the data of all models, Rollback restores it and Commit discards it,
+// transactions can be nested as savepoints, the data of tenants and seed profiles is not included,
+// e.g. call Begin before every test and defer Rollback to isolate tests without reloading files
+func (af *ApiFaker) Begin() {
+	af.Lock()
+	defer af.Unlock()
+
+	savepoint := map[string]modelSnapshot{}
+	for name, router := range af.Routers {
+		savepoint[name] = router.Model.takeSnapshot()
+	}
+	af.savepoints = append(af.savepoints, savepoint)
+}
+
+// Commit discards the snapshot taken by the last Begin and keeps the current data
+func (af *ApiFaker) Commit() error {
+	_, err := af.popSavepoint()
+	return err
+}
+
+// Rollback restores the data of all models to the snapshot taken by the last Begin
+func (af *ApiFaker) Rollback() error {
+	savepoint, err := af.popSavepoint()
+	if err != nil {
+		return err
+	}
+
+	for name, snapshot := range savepoint {
+		if router, ok := af.routers()[name]; ok {
+			if err := router.Model.restoreSnapshot(snapshot); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// popSavepoint removes and returns the last savepoint
+func (af *ApiFaker) popSavepoint() (map[string]modelSnapshot, error) {
+	af.Lock()
+	defer af.Unlock()
+
+	if len(af.savepoints) == 0 {
+		return nil, TransactionErrorf("no transaction, call Begin first")
+	}
+	savepoint := af.savepoints[len(af.savepoints)-1]
+	af.savepoints = af.savepoints[:len(af.savepoints)-1]
+	return savepoint, nil
+}
@@ -0,0 +1,97 @@
+package apifaker
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// builtinTransforms contains the built-in functions to normalize string values on write using their names as keys,
+// custom ones are registered to an ApiFaker by RegisterTransform
+var builtinTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": titleCase,
+}
+
+// transformRegistry contains the custom transforms of an ApiFaker using their names as keys,
+// the tenants of the ApiFaker share it
+type transformRegistry struct {
+	funcs map[string]func(string) string
+	sync.RWMutex
+}
+
+// newTransformRegistry allocates and returns a new empty transformRegistry
+func newTransformRegistry() *transformRegistry {
+	return &transformRegistry{funcs: map[string]func(string) string{}}
+}
+
+// RegisterTransform registers a custom transform with the given name for Column.Transform of the models of af,
+// it overrides the built-in one with the same name, register it before AddModel of the models using it
+func (af *ApiFaker) RegisterTransform(name string, transform func(string) string) {
+	af.Lock()
+	if af.transforms == nil {
+		af.transforms = newTransformRegistry()
+	}
+	registry := af.transforms
+	af.Unlock()
+
+	registry.Lock()
+	defer registry.Unlock()
+	registry.funcs[name] = transform
+}
+
+// transformFunc returns the transform with the given name and if it exists,
+// the custom ones registered to the ApiFaker of the Model override the built-in ones
+func (model *Model) transformFunc(name string) (func(string) string, bool) {
+	if model != nil && model.router != nil && model.router.apiFaker != nil && model.router.apiFaker.transforms != nil {
+		registry := model.router.apiFaker.transforms
+		registry.RLock()
+		transform, ok := registry.funcs[name]
+		registry.RUnlock()
+		if ok {
+			return transform, true
+		}
+	}
+
+	transform, ok := builtinTransforms[name]
+	return transform, ok
+}
+
+// titleCase returns the string with the first letter of every word in upper case and others in lower case,
+// e.g. "john SMITH" to "John Smith"
+func titleCase(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || !unicode.IsLetter(runes[i-1]) {
+			runes[i] = unicode.ToUpper(r)
+		} else {
+			runes[i] = unicode.ToLower(r)
+		}
+	}
+	return string(runes)
+}
+
+// transformNames returns the names of transforms of the column in order
+func (column *Column) transformNames() []string {
+	if column.Transform == "" {
+		return nil
+	}
+
+	names := strings.Split(column.Transform, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+	return names
+}
+
+// transform returns the string value transformed by the transforms of the column of the Model in order
+func (column *Column) transform(value string, model *Model) string {
+	for _, name := range column.transformNames() {
+		if transform, ok := model.transformFunc(name); ok {
+			value = transform(value)
+		}
+	}
+	return value
+}